@@ -0,0 +1,304 @@
+package alarm
+
+import (
+	"context"
+	"fmt"
+	"go-oak/poller"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// notifyQueue 每个 Notifier 等待发送的事件数
+const notifyQueue = 100
+
+// State 报警状态
+type State string
+
+const (
+	StateActive  State = "active"  // 报警
+	StateCleared State = "cleared" // 恢复
+)
+
+// Event 一次报警状态变化
+type Event struct {
+	Rule     string    `json:"rule"`
+	Kind     Kind      `json:"type"`
+	Severity string    `json:"severity,omitempty"`
+	Device   string    `json:"device"`
+	Tag      string    `json:"tag"`
+	State    State     `json:"state"`
+	Value    *float64  `json:"value,omitempty"`
+	Message  string    `json:"message"`
+	Time     time.Time `json:"time"`
+}
+
+func (e *Event) String() string {
+	if e.Tag == "" {
+		return fmt.Sprintf("[%s] %s %s: %s", e.State, e.Rule, e.Device, e.Message)
+	}
+	return fmt.Sprintf("[%s] %s %s.%s: %s", e.State, e.Rule, e.Device, e.Tag, e.Message)
+}
+
+// key 一条规则在一个点位上的状态，没有指定点位的 comm 规则按设备记录，tag 为空
+type key struct {
+	rule        *Rule
+	device, tag string
+}
+
+type ruleState struct {
+	active bool
+	// pending 条件开始满足的时间，零值表示条件不满足
+	pending time.Time
+	// hasValue、value、at 上一次成功读取的值和时间
+	hasValue bool
+	value    float64
+	at       time.Time
+	// changed 值最后一次变化的时间
+	changed time.Time
+	// rate 最近一次计算的变化率，每分钟
+	rate float64
+	// err 最近一次读取的错误，failed 中的点位都恢复后为 nil
+	err error
+	// failed 最近一次读取失败的点位
+	failed map[string]error
+}
+
+// setErr 记录点位的读取结果，按设备记录时任一点位失败都算失败
+func (st *ruleState) setErr(tag string, err error) {
+	if err != nil {
+		if st.failed == nil {
+			st.failed = make(map[string]error)
+		}
+		st.failed[tag] = err
+		st.err = err
+		return
+	}
+	delete(st.failed, tag)
+	if len(st.failed) == 0 {
+		st.err = nil
+	}
+}
+
+// Engine 按规则检查采集结果，报警状态变化时通知所有 Notifier 并记录历史。
+// 作为 poller.Handler 使用，另外需要 Run 定时检查 stale 规则和报警延时。
+type Engine struct {
+	mu        sync.Mutex
+	rules     []*Rule
+	states    map[key]*ruleState
+	notifiers []chan *Event
+	history   *History
+	now       func() time.Time
+}
+
+// NewEngine 创建报警引擎，history 为 nil 时不记录历史
+func NewEngine(rules []*Rule, history *History) (*Engine, error) {
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &Engine{
+		rules:   rules,
+		states:  make(map[key]*ruleState),
+		history: history,
+		now:     time.Now,
+	}, nil
+}
+
+// AddNotifier 添加通知方式。每个 Notifier 在自己的 goroutine 中按顺序收到事件，
+// 通知较慢（webhook、外部命令）时不阻塞轮询
+func (e *Engine) AddNotifier(n Notifier) {
+	events := make(chan *Event, notifyQueue)
+	e.notifiers = append(e.notifiers, events)
+	go func() {
+		for ev := range events {
+			if err := n.Notify(ev); err != nil {
+				log.Printf("alarm: 通知失败: %v", err)
+			}
+		}
+	}()
+}
+
+// HandleReading 实现 poller.Handler
+func (e *Engine) HandleReading(r *poller.Reading) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, rule := range e.rules {
+		if !rule.match(r.Device.Name, r.Tag.Name) {
+			continue
+		}
+		k := key{rule, r.Device.Name, r.Tag.Name}
+		if rule.Kind == KindComm && rule.Tag == "" {
+			// 设备通信中断时所有点位都会失败，只报一次警
+			k.tag = ""
+		}
+		st, ok := e.states[k]
+		if !ok {
+			st = &ruleState{}
+			e.states[k] = st
+		}
+		st.setErr(r.Tag.Name, r.Err)
+		if r.Err == nil && k.tag != "" {
+			if !st.hasValue || r.Value != st.value {
+				st.changed = r.Time
+			}
+			if st.hasValue {
+				if minutes := r.Time.Sub(st.at).Minutes(); minutes > 0 {
+					st.rate = (r.Value - st.value) / minutes
+				}
+			}
+			st.hasValue, st.value, st.at = true, r.Value, r.Time
+		}
+		e.evaluate(k, st, r.Time)
+	}
+}
+
+// Run 每秒检查一次 stale 规则和报警延时，直到 ctx 结束
+func (e *Engine) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.Check()
+		}
+	}
+}
+
+// Check 按当前时间重新检查所有状态
+func (e *Engine) Check() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.now()
+	for k, st := range e.states {
+		e.evaluate(k, st, now)
+	}
+}
+
+// evaluate 计算规则的报警和恢复条件，更新报警状态
+func (e *Engine) evaluate(k key, st *ruleState, now time.Time) {
+	r := k.rule
+	var raise, clear bool
+	var message string
+	switch r.Kind {
+	case KindComm:
+		raise, clear = st.err != nil, st.err == nil
+		if raise {
+			message = "通信失败: " + st.err.Error()
+		} else {
+			message = "通信恢复"
+		}
+	case KindStale:
+		if !st.hasValue {
+			return
+		}
+		unchanged := now.Sub(st.changed)
+		raise, clear = unchanged >= r.Timeout, unchanged < r.Timeout
+		message = fmt.Sprintf("值 %v 已 %v 没有变化", st.value, unchanged.Round(time.Second))
+	default:
+		if !st.hasValue || st.err != nil {
+			return
+		}
+		raise, clear, message = r.limit(st)
+	}
+
+	if st.active {
+		if clear {
+			st.active = false
+			st.pending = time.Time{}
+			e.emit(k, st, StateCleared, message, now)
+		}
+		return
+	}
+	if !raise {
+		st.pending = time.Time{}
+		return
+	}
+	if st.pending.IsZero() {
+		st.pending = now
+	}
+	if now.Sub(st.pending) >= r.Delay {
+		st.active = true
+		e.emit(k, st, StateActive, message, now)
+	}
+}
+
+// limit 计算 high、low、rate 规则的条件
+func (r *Rule) limit(st *ruleState) (raise, clear bool, message string) {
+	switch r.Kind {
+	case KindHigh:
+		raise, clear = st.value > r.Limit, st.value < r.Limit-r.Hysteresis
+		message = fmt.Sprintf("值 %v 高于上限 %v", st.value, r.Limit)
+		if !raise {
+			message = fmt.Sprintf("值 %v 恢复正常", st.value)
+		}
+	case KindLow:
+		raise, clear = st.value < r.Limit, st.value > r.Limit+r.Hysteresis
+		message = fmt.Sprintf("值 %v 低于下限 %v", st.value, r.Limit)
+		if !raise {
+			message = fmt.Sprintf("值 %v 恢复正常", st.value)
+		}
+	case KindRate:
+		rate := math.Abs(st.rate)
+		raise, clear = rate > r.Limit, rate < r.Limit-r.Hysteresis
+		message = fmt.Sprintf("变化率 %.3g/分钟 超过 %v", st.rate, r.Limit)
+		if !raise {
+			message = fmt.Sprintf("变化率 %.3g/分钟 恢复正常", st.rate)
+		}
+	}
+	return
+}
+
+// emit 通知报警状态变化，调用者需持有 e.mu
+func (e *Engine) emit(k key, st *ruleState, state State, message string, now time.Time) {
+	ev := &Event{
+		Rule:     k.rule.Name,
+		Kind:     k.rule.Kind,
+		Severity: k.rule.Severity,
+		Device:   k.device,
+		Tag:      k.tag,
+		State:    state,
+		Message:  message,
+		Time:     now,
+	}
+	if st.hasValue {
+		v := st.value
+		ev.Value = &v
+	}
+	if e.history != nil {
+		if err := e.history.Add(ev); err != nil {
+			log.Printf("alarm: 记录历史失败: %v", err)
+		}
+	}
+	for _, events := range e.notifiers {
+		select {
+		case events <- ev:
+		default:
+			log.Printf("alarm: 通知队列已满，丢弃 %v", ev)
+		}
+	}
+}
+
+// Active 返回当前处于报警状态的规则和点位
+func (e *Engine) Active() (events []*Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for k, st := range e.states {
+		if st.active {
+			ev := &Event{Rule: k.rule.Name, Kind: k.rule.Kind, Severity: k.rule.Severity,
+				Device: k.device, Tag: k.tag, State: StateActive, Time: st.pending}
+			if st.hasValue {
+				v := st.value
+				ev.Value = &v
+			}
+			events = append(events, ev)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return
+}
@@ -0,0 +1,139 @@
+package alarm
+
+import (
+	"errors"
+	"go-oak/poller"
+	"go-oak/regmap"
+	"testing"
+	"time"
+)
+
+// testEngine 用内存中的历史记录事件，时间由测试控制
+type testEngine struct {
+	*Engine
+	t       *testing.T
+	history *History
+	device  *regmap.Device
+	now     time.Time
+}
+
+func newTestEngine(t *testing.T, rules ...*Rule) *testEngine {
+	history, _ := NewHistory("", 0)
+	e, err := NewEngine(rules, history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	te := &testEngine{Engine: e, t: t, history: history, device: &regmap.Device{Name: "th01", UnitID: 1},
+		now: time.Date(2022, 8, 1, 0, 0, 0, 0, time.Local)}
+	e.now = func() time.Time { return te.now }
+	return te
+}
+
+// read 经过 d 后收到点位的读数
+func (te *testEngine) read(d time.Duration, tag string, value float64, err error) {
+	te.now = te.now.Add(d)
+	te.HandleReading(&poller.Reading{Device: te.device, Tag: &regmap.Tag{Name: tag}, Value: value, Time: te.now, Err: err})
+}
+
+// check 经过 d 后定时检查
+func (te *testEngine) check(d time.Duration) {
+	te.now = te.now.Add(d)
+	te.Check()
+}
+
+// expect 检查到目前为止的事件状态序列
+func (te *testEngine) expect(states ...State) {
+	te.t.Helper()
+	events := te.history.Events()
+	if len(events) != len(states) {
+		te.t.Fatalf("事件 %v，预期状态 %v", events, states)
+	}
+	for i, e := range events {
+		if e.State != states[i] {
+			te.t.Fatalf("事件 %v，预期状态 %v", events, states)
+		}
+	}
+}
+
+func TestHighHysteresis(t *testing.T) {
+	e := newTestEngine(t, &Rule{Name: "温度高", Tag: "t", Kind: KindHigh, Limit: 8, Hysteresis: 0.5})
+	e.read(time.Second, "t", 7, nil)
+	e.expect()
+	e.read(time.Second, "t", 8.5, nil)
+	e.expect(StateActive)
+	// 回到限值以下但没有超过回差，不恢复
+	e.read(time.Second, "t", 7.8, nil)
+	e.read(time.Second, "t", 8.2, nil)
+	e.expect(StateActive)
+	e.read(time.Second, "t", 7.4, nil)
+	e.expect(StateActive, StateCleared)
+	if len(e.Active()) != 0 {
+		t.Fatal("恢复后不应该有报警")
+	}
+}
+
+func TestLowDelay(t *testing.T) {
+	e := newTestEngine(t, &Rule{Name: "压力低", Kind: KindLow, Limit: 1, Delay: 5 * time.Minute})
+	e.read(0, "p", 0.5, nil)
+	e.check(4 * time.Minute)
+	e.expect()
+	// 延时内恢复，重新计时
+	e.read(time.Minute/2, "p", 1.5, nil)
+	e.read(time.Minute, "p", 0.5, nil)
+	e.check(4 * time.Minute)
+	e.expect()
+	e.check(time.Minute)
+	e.expect(StateActive)
+	if active := e.Active(); len(active) != 1 || active[0].Tag != "p" {
+		t.Fatalf("当前报警 %v", active)
+	}
+}
+
+func TestStale(t *testing.T) {
+	e := newTestEngine(t, &Rule{Name: "卡死", Tag: "h", Kind: KindStale, Timeout: 30 * time.Minute})
+	e.read(0, "h", 50, nil)
+	e.read(10*time.Minute, "h", 50, nil)
+	e.check(19 * time.Minute)
+	e.expect()
+	e.check(time.Minute)
+	e.expect(StateActive)
+	e.read(time.Minute, "h", 51, nil)
+	e.expect(StateActive, StateCleared)
+}
+
+func TestRate(t *testing.T) {
+	e := newTestEngine(t, &Rule{Name: "变化快", Tag: "t", Kind: KindRate, Limit: 2, Hysteresis: 0.5})
+	e.read(0, "t", 10, nil)
+	e.read(time.Minute, "t", 11, nil)
+	e.expect()
+	e.read(time.Minute, "t", 15, nil) // 4/分钟
+	e.expect(StateActive)
+	e.read(time.Minute, "t", 16.8, nil) // 1.8/分钟，没有超过回差
+	e.expect(StateActive)
+	e.read(time.Minute, "t", 17, nil)
+	e.expect(StateActive, StateCleared)
+}
+
+func TestCommPerDevice(t *testing.T) {
+	e := newTestEngine(t, &Rule{Name: "通信中断", Device: "th01", Kind: KindComm})
+	timeout := errors.New("timeout")
+	for _, tag := range []string{"t", "h", "p"} {
+		e.read(time.Second, tag, 0, timeout)
+	}
+	e.expect(StateActive)
+	if ev := e.history.Events()[0]; ev.Device != "th01" || ev.Tag != "" {
+		t.Fatalf("按设备报警的事件 %+v", ev)
+	}
+	// 所有点位恢复后才恢复
+	e.read(time.Second, "t", 1, nil)
+	e.read(time.Second, "h", 1, nil)
+	e.expect(StateActive)
+	e.read(time.Second, "p", 1, nil)
+	e.expect(StateActive, StateCleared)
+
+	// 指定了点位的 comm 规则按点位报警
+	e = newTestEngine(t, &Rule{Name: "通信中断", Tag: "t", Kind: KindComm})
+	e.read(time.Second, "t", 0, timeout)
+	e.read(time.Second, "h", 0, timeout)
+	e.expect(StateActive)
+}
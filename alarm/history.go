@@ -0,0 +1,96 @@
+package alarm
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// DefaultHistoryMaxSize 报警历史文件的默认大小上限
+const DefaultHistoryMaxSize = 10 << 20
+
+// History 报警历史，保存在内存中，指定文件时同时以 JSON 行追加到文件。
+// 文件超过 MaxSize 后改名为 <文件>.1（覆盖上一个），再写入新文件，
+// 磁盘上最多保留两个文件。
+type History struct {
+	// Max 内存中最多保留的事件数
+	Max int
+	// MaxSize 历史文件的大小上限（字节），<= 0 表示不限制
+	MaxSize int64
+
+	mu     sync.Mutex
+	events []*Event
+	path   string
+}
+
+// NewHistory 创建报警历史，path 不为空时先读入文件（包括切换下来的 <文件>.1）中已有的记录
+func NewHistory(path string, max int) (h *History, err error) {
+	h = &History{Max: max, MaxSize: DefaultHistoryMaxSize, path: path}
+	if path == "" {
+		return
+	}
+	for _, name := range []string{path + ".1", path} {
+		if err = h.load(name); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// load 读入一个历史文件，文件不存在时忽略
+func (h *History) load(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			h.append(&e)
+		}
+	}
+	return scanner.Err()
+}
+
+// Add 记录一次报警状态变化
+func (h *History) Add(e *Event) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.append(e)
+	if h.path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(f).Encode(e)
+	info, statErr := f.Stat()
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil || statErr != nil || h.MaxSize <= 0 || info.Size() < h.MaxSize {
+		return err
+	}
+	return os.Rename(h.path, h.path+".1")
+}
+
+func (h *History) append(e *Event) {
+	h.events = append(h.events, e)
+	if h.Max > 0 && len(h.events) > h.Max {
+		h.events = h.events[len(h.events)-h.Max:]
+	}
+}
+
+// Events 返回按时间顺序的历史事件
+func (h *History) Events() []*Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]*Event(nil), h.events...)
+}
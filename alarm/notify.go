@@ -0,0 +1,126 @@
+package alarm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// Notifier 报警通知方式
+type Notifier interface {
+	Notify(e *Event) error
+}
+
+// LogNotifier 把报警写入日志
+type LogNotifier struct {
+	Logger *log.Logger
+}
+
+func (n *LogNotifier) Notify(e *Event) error {
+	if n.Logger == nil {
+		log.Println("alarm:", e)
+		return nil
+	}
+	n.Logger.Println(e)
+	return nil
+}
+
+// Webhook 以 JSON 把报警 POST 到 URL
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhook 创建 Webhook 通知
+func NewWebhook(url string) *Webhook {
+	return &Webhook{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (n *Webhook) Notify(e *Event) error {
+	data, _ := json.Marshal(e)
+	resp, err := n.Client.Post(n.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook %s: %s", n.URL, resp.Status)
+	}
+	return nil
+}
+
+// Command 执行外部命令通知报警。报警以 JSON 写入标准输入，
+// 同时设置 ALARM_RULE、ALARM_STATE、ALARM_DEVICE、ALARM_TAG、ALARM_VALUE、ALARM_MESSAGE 等环境变量
+type Command struct {
+	Args    []string
+	Timeout time.Duration
+}
+
+// NewCommand 创建执行 args 的通知
+func NewCommand(args []string) *Command {
+	return &Command{Args: args, Timeout: 30 * time.Second}
+}
+
+func (n *Command) Notify(e *Event) error {
+	if len(n.Args) == 0 {
+		return fmt.Errorf("没有指定通知命令")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), n.Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, n.Args[0], n.Args[1:]...)
+	data, _ := json.Marshal(e)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Env = append(os.Environ(),
+		"ALARM_RULE="+e.Rule,
+		"ALARM_TYPE="+string(e.Kind),
+		"ALARM_SEVERITY="+e.Severity,
+		"ALARM_STATE="+string(e.State),
+		"ALARM_DEVICE="+e.Device,
+		"ALARM_TAG="+e.Tag,
+		"ALARM_MESSAGE="+e.Message,
+		"ALARM_TIME="+e.Time.Format(time.RFC3339),
+	)
+	if e.Value != nil {
+		cmd.Env = append(cmd.Env, "ALARM_VALUE="+strconv.FormatFloat(*e.Value, 'g', -1, 64))
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("命令 %s: %w: %s", n.Args[0], err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// NotifierConfig 配置文件中的通知方式
+type NotifierConfig struct {
+	// Type log、webhook 或 exec
+	Type    string   `yaml:"type"`
+	URL     string   `yaml:"url"`
+	Command []string `yaml:"command"`
+}
+
+// NewNotifier 按配置创建通知方式
+func NewNotifier(c *NotifierConfig) (Notifier, error) {
+	switch c.Type {
+	case "log":
+		return &LogNotifier{}, nil
+	case "webhook":
+		if c.URL == "" {
+			return nil, fmt.Errorf("webhook 通知需要 url")
+		}
+		return NewWebhook(c.URL), nil
+	case "exec":
+		if len(c.Command) == 0 {
+			return nil, fmt.Errorf("exec 通知需要 command")
+		}
+		return NewCommand(c.Command), nil
+	}
+	return nil, fmt.Errorf("未知的通知方式 '%s'，可以是 log/webhook/exec", c.Type)
+}
@@ -0,0 +1,69 @@
+package alarm
+
+import (
+	"fmt"
+	"time"
+)
+
+// Kind 报警规则的类型
+type Kind string
+
+const (
+	// KindHigh 值高于 Limit
+	KindHigh Kind = "high"
+	// KindLow 值低于 Limit
+	KindLow Kind = "low"
+	// KindRate 变化率（每分钟）的绝对值超过 Limit
+	KindRate Kind = "rate"
+	// KindStale 值超过 Timeout 没有变化，例如传感器卡死
+	KindStale Kind = "stale"
+	// KindComm 读取失败（超时、CRC 错误、异常响应等）
+	KindComm Kind = "comm"
+)
+
+// Rule 一条报警规则。Device 或 Tag 为空时匹配所有设备或点位，
+// 每个匹配的点位单独维护报警状态。没有指定 Tag 的 comm 规则按设备维护，
+// 任一点位读取失败即报警，所有失败的点位都读取成功后恢复。
+type Rule struct {
+	Name     string `yaml:"name" json:"name"`
+	Device   string `yaml:"device" json:"device,omitempty"`
+	Tag      string `yaml:"tag" json:"tag,omitempty"`
+	Kind     Kind   `yaml:"type" json:"type"`
+	Severity string `yaml:"severity" json:"severity,omitempty"`
+	// Limit high/low 的限值，rate 为每分钟最大变化量
+	Limit float64 `yaml:"limit" json:"limit,omitempty"`
+	// Hysteresis 回差，值回到限值内侧超过回差后才恢复，避免在限值附近反复报警
+	Hysteresis float64 `yaml:"hysteresis" json:"hysteresis,omitempty"`
+	// Delay 条件持续满足多久后才报警
+	Delay time.Duration `yaml:"delay" json:"delay,omitempty"`
+	// Timeout stale 规则中值多久没有变化算作报警
+	Timeout time.Duration `yaml:"timeout" json:"timeout,omitempty"`
+}
+
+// Validate 检查规则的参数
+func (r *Rule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("报警规则没有名称")
+	}
+	switch r.Kind {
+	case KindHigh, KindLow, KindComm:
+	case KindRate:
+		if r.Limit <= 0 {
+			return fmt.Errorf("报警规则 %s: rate 的 limit 必须大于 0", r.Name)
+		}
+	case KindStale:
+		if r.Timeout <= 0 {
+			return fmt.Errorf("报警规则 %s: stale 需要 timeout", r.Name)
+		}
+	default:
+		return fmt.Errorf("报警规则 %s: 未知的类型 '%s'，可以是 high/low/rate/stale/comm", r.Name, r.Kind)
+	}
+	if r.Hysteresis < 0 || r.Delay < 0 {
+		return fmt.Errorf("报警规则 %s: hysteresis 和 delay 不能为负", r.Name)
+	}
+	return nil
+}
+
+func (r *Rule) match(device, tag string) bool {
+	return (r.Device == "" || r.Device == device) && (r.Tag == "" || r.Tag == tag)
+}
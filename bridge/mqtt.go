@@ -0,0 +1,180 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-oak/poller"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// DefaultPrefix 默认的主题前缀
+const DefaultPrefix = "go-oak"
+
+// Options MQTT 连接和发布参数
+type Options struct {
+	// Broker 服务器地址，如 tcp://localhost:1883
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+	// Prefix 主题前缀，点位的值发布到 <Prefix>/<设备>/<点位>
+	Prefix string
+	QoS    byte
+	// Retain 是否保留最后一次的值，新订阅者可以立即收到
+	Retain bool
+}
+
+// Payload 发布的点位值
+type Payload struct {
+	Device string    `json:"device"`
+	Tag    string    `json:"tag"`
+	Value  *float64  `json:"value,omitempty"`
+	Unit   string    `json:"unit,omitempty"`
+	Time   time.Time `json:"time"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// Command 写入命令。消息也可以直接是一个数字
+type Command struct {
+	Value *float64 `json:"value"`
+}
+
+// MQTT 把 Poller 采集的点位值发布到 MQTT，并把命令主题上的消息写入设备。
+//
+// 主题：
+//
+//	<prefix>/<device>/<tag>            点位的值（JSON）
+//	<prefix>/<device>/<tag>/set        写入命令，写入成功后立即重新读取并发布
+//	<prefix>/<device>/<tag>.<bit>/set  只修改保持寄存器中的一位，值非 0 置 1
+//	<prefix>/<device>/<tag>/result     写入结果
+//	<prefix>/status                    online/offline（遗嘱消息）
+type MQTT struct {
+	opts   Options
+	poller *poller.Poller
+	client paho.Client
+}
+
+// NewMQTT 创建 MQTT 桥接，需要在 Poller 上注册 HandleReading
+func NewMQTT(p *poller.Poller, opts Options) *MQTT {
+	if opts.Prefix == "" {
+		opts.Prefix = DefaultPrefix
+	}
+	opts.Prefix = strings.TrimSuffix(opts.Prefix, "/")
+	if opts.ClientID == "" {
+		opts.ClientID = fmt.Sprintf("go-oak-%d", time.Now().UnixNano()%100000)
+	}
+	return &MQTT{opts: opts, poller: p}
+}
+
+// Connect 连接服务器并订阅命令主题，断线后自动重连并重新订阅
+func (m *MQTT) Connect() error {
+	status := m.opts.Prefix + "/status"
+	co := paho.NewClientOptions().
+		AddBroker(m.opts.Broker).
+		SetClientID(m.opts.ClientID).
+		SetUsername(m.opts.Username).
+		SetPassword(m.opts.Password).
+		SetAutoReconnect(true).
+		SetWill(status, "offline", 1, true).
+		SetOnConnectHandler(func(c paho.Client) {
+			c.Publish(status, 1, true, "online")
+			topic := m.opts.Prefix + "/+/+/set"
+			if t := c.Subscribe(topic, m.opts.QoS, m.onCommand); t.Wait() && t.Error() != nil {
+				log.Printf("mqtt: 订阅 %s 失败: %v", topic, t.Error())
+			}
+		}).
+		SetConnectionLostHandler(func(c paho.Client, err error) {
+			log.Printf("mqtt: 连接断开: %v", err)
+		})
+	m.client = paho.NewClient(co)
+	if t := m.client.Connect(); t.Wait() && t.Error() != nil {
+		return fmt.Errorf("mqtt: 连接 %s 失败: %w", m.opts.Broker, t.Error())
+	}
+	return nil
+}
+
+// HandleReading 实现 poller.Handler，发布点位的值
+func (m *MQTT) HandleReading(r *poller.Reading) {
+	p := Payload{Device: r.Device.Name, Tag: r.Tag.Name, Unit: r.Tag.Unit, Time: r.Time}
+	if r.Err != nil {
+		p.Error = r.Err.Error()
+	} else {
+		value := r.Value
+		p.Value = &value
+	}
+	data, _ := json.Marshal(p)
+	m.client.Publish(m.topic(r.Device.Name, r.Tag.Name), m.opts.QoS, m.opts.Retain, data)
+}
+
+// onCommand 处理 <prefix>/<device>/<tag>/set 上的写入命令
+func (m *MQTT) onCommand(c paho.Client, msg paho.Message) {
+	parts := strings.Split(strings.TrimPrefix(msg.Topic(), m.opts.Prefix+"/"), "/")
+	if len(parts) != 3 {
+		return
+	}
+	device, tag := parts[0], parts[1]
+	// 回调在 paho 的消息 goroutine 中执行，写总线可能较慢，另起 goroutine
+	go func() {
+		result := "ok"
+		if err := m.write(device, tag, msg.Payload()); err != nil {
+			log.Printf("mqtt: %s: %v", msg.Topic(), err)
+			result = err.Error()
+		} else {
+			// 重新读取，发布写入后的值；写入一位时读取整个点位
+			name := tag
+			if d, err := m.poller.Database().Device(device); err == nil {
+				if n, _, ok := d.SplitBit(tag); ok {
+					name = n
+				}
+			}
+			_, _ = m.poller.Read(device, name)
+		}
+		c.Publish(m.topic(device, tag)+"/result", m.opts.QoS, false, result)
+	}()
+}
+
+func (m *MQTT) write(device, tag string, payload []byte) error {
+	value, err := parseCommand(payload)
+	if err != nil {
+		return err
+	}
+	return m.poller.Write(device, tag, value)
+}
+
+// parseCommand 解析写入命令，可以是数字、true/false 或 {"value": 数字}
+func parseCommand(payload []byte) (float64, error) {
+	s := strings.TrimSpace(string(payload))
+	switch strings.ToLower(s) {
+	case "true", "on":
+		return 1, nil
+	case "false", "off":
+		return 0, nil
+	}
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return v, nil
+	}
+	var cmd Command
+	if err := json.Unmarshal(payload, &cmd); err != nil || cmd.Value == nil {
+		return 0, fmt.Errorf("无法解析写入命令 '%s'", s)
+	}
+	return *cmd.Value, nil
+}
+
+func (m *MQTT) topic(device, tag string) string {
+	return m.opts.Prefix + "/" + device + "/" + tag
+}
+
+// Close 发布离线状态并断开连接
+func (m *MQTT) Close() {
+	if m.client == nil {
+		return
+	}
+	// 服务器已断开时不能一直等待
+	m.client.Publish(m.opts.Prefix+"/status", 1, true, "offline").WaitTimeout(time.Second)
+	m.client.Disconnect(250)
+}
@@ -0,0 +1,317 @@
+package bridge
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"go-oak/cli"
+	"go-oak/poller"
+	"go-oak/regmap"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// broker 测试用的最小 MQTT 3.1.1 服务器：支持 CONNECT、SUBSCRIBE、PUBLISH（QoS 0/1）、
+// 保留消息和心跳，收到的消息按 QoS 0 转发给匹配的订阅者
+type broker struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	subs     map[*brokerConn][]string
+	retained map[string][]byte
+}
+
+type brokerConn struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (c *brokerConn) send(header byte, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	packet := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	_, _ = c.conn.Write(append(packet, body...))
+}
+
+func (c *brokerConn) publish(topic string, payload []byte) {
+	body := appendUint16(nil, uint16(len(topic)))
+	body = append(body, topic...)
+	c.send(0x30, append(body, payload...))
+}
+
+func newBroker(t *testing.T) *broker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &broker{ln: ln, subs: make(map[*brokerConn][]string), retained: make(map[string][]byte)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(&brokerConn{conn: conn})
+		}
+	}()
+	t.Cleanup(func() { _ = ln.Close() })
+	return b
+}
+
+func (b *broker) url() string {
+	return "tcp://" + b.ln.Addr().String()
+}
+
+func (b *broker) serve(c *brokerConn) {
+	defer func() {
+		b.mu.Lock()
+		delete(b.subs, c)
+		b.mu.Unlock()
+		_ = c.conn.Close()
+	}()
+	r := bufio.NewReader(c.conn)
+	for {
+		header, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		length, err := binary.ReadUvarint(r)
+		if err != nil {
+			return
+		}
+		body := make([]byte, length)
+		if _, err = io.ReadFull(r, body); err != nil {
+			return
+		}
+		switch header >> 4 {
+		case 1: // CONNECT
+			c.send(0x20, []byte{0, 0})
+		case 3: // PUBLISH
+			qos := header >> 1 & 3
+			n := int(binary.BigEndian.Uint16(body))
+			topic := string(body[2 : 2+n])
+			rest := body[2+n:]
+			if qos > 0 {
+				c.send(0x40, rest[:2])
+				rest = rest[2:]
+			}
+			b.route(topic, rest, header&1 == 1)
+		case 8: // SUBSCRIBE
+			pid, rest := body[:2], body[2:]
+			ack := append([]byte(nil), pid...)
+			var filters []string
+			for len(rest) > 0 {
+				n := int(binary.BigEndian.Uint16(rest))
+				filters = append(filters, string(rest[2:2+n]))
+				rest = rest[3+n:]
+				ack = append(ack, 0)
+			}
+			b.mu.Lock()
+			b.subs[c] = append(b.subs[c], filters...)
+			var retained [][2]string
+			for topic, payload := range b.retained {
+				for _, f := range filters {
+					if topicMatch(f, topic) {
+						retained = append(retained, [2]string{topic, string(payload)})
+						break
+					}
+				}
+			}
+			b.mu.Unlock()
+			c.send(0x90, ack)
+			for _, m := range retained {
+				c.publish(m[0], []byte(m[1]))
+			}
+		case 12: // PINGREQ
+			c.send(0xD0, nil)
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+func (b *broker) route(topic string, payload []byte, retain bool) {
+	b.mu.Lock()
+	if retain {
+		b.retained[topic] = payload
+	}
+	var targets []*brokerConn
+	for c, filters := range b.subs {
+		for _, f := range filters {
+			if topicMatch(f, topic) {
+				targets = append(targets, c)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+	for _, c := range targets {
+		c.publish(topic, payload)
+	}
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+// topicMatch 按 MQTT 通配符 + 和 # 匹配主题
+func topicMatch(filter, topic string) bool {
+	f, t := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, part := range f {
+		if part == "#" {
+			return true
+		}
+		if i >= len(t) || (part != "+" && part != t[i]) {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
+
+// fakeClient 用内存中的保持寄存器代替从站，只实现测试用到的方法
+type fakeClient struct {
+	cli.Client
+	mu   sync.Mutex
+	regs map[uint16]uint16
+}
+
+func (c *fakeClient) SetSlaveId(id byte) {}
+
+func (c *fakeClient) ReadHoldingRegisters(address, quantity uint16) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var res []byte
+	for i := uint16(0); i < quantity; i++ {
+		res = appendUint16(res, c.regs[address+i])
+	}
+	return res, nil
+}
+
+func (c *fakeClient) WriteSingleRegister(address, value uint16) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.regs[address] = value
+	return appendUint16(nil, value), nil
+}
+
+func (c *fakeClient) Close() error { return nil }
+
+// subscribe 连接到 broker 并订阅 filter，收到的消息写入返回的通道
+func subscribe(t *testing.T, url, filter string) <-chan paho.Message {
+	ch := make(chan paho.Message, 32)
+	c := paho.NewClient(paho.NewClientOptions().AddBroker(url).SetClientID("test-sub"))
+	if tk := c.Connect(); tk.Wait() && tk.Error() != nil {
+		t.Fatal(tk.Error())
+	}
+	t.Cleanup(func() { c.Disconnect(0) })
+	if tk := c.Subscribe(filter, 0, func(_ paho.Client, m paho.Message) { ch <- m }); tk.Wait() && tk.Error() != nil {
+		t.Fatal(tk.Error())
+	}
+	return ch
+}
+
+// expect 等待主题为 topic 的消息，忽略其他主题
+func expect(t *testing.T, ch <-chan paho.Message, topic string) []byte {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case m := <-ch:
+			if m.Topic() == topic {
+				return m.Payload()
+			}
+		case <-timeout:
+			t.Fatalf("没有收到 %s", topic)
+		}
+	}
+}
+
+func TestMQTTPublishAndSet(t *testing.T) {
+	b := newBroker(t)
+	fake := &fakeClient{regs: map[uint16]uint16{10: 215}}
+	m, _ := regmap.NewMap(&regmap.Tag{
+		Name: "setpoint", Area: regmap.AreaHoldingRegister, Address: 10,
+		Scale: 0.1, Unit: "℃", Access: regmap.ReadWrite,
+	})
+	db := regmap.NewDatabase()
+	db.Add(&regmap.Device{Name: "th01", UnitID: 1, Map: m})
+	p := poller.New(db, func(string) (cli.Client, error) { return fake, nil })
+
+	bridge := NewMQTT(p, Options{Broker: b.url(), Prefix: "test/"})
+	p.Handle(bridge.HandleReading)
+	if err := bridge.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer bridge.Close()
+	msgs := subscribe(t, b.url(), "test/#")
+
+	if s := expect(t, msgs, "test/status"); string(s) != "online" {
+		t.Fatalf("状态 %s，预期 online", s)
+	}
+
+	p.PollOnce()
+	var payload Payload
+	if err := json.Unmarshal(expect(t, msgs, "test/th01/setpoint"), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Value == nil || *payload.Value != 21.5 || payload.Unit != "℃" {
+		t.Fatalf("发布的值不正确: %+v", payload)
+	}
+
+	// 写入命令：写寄存器、返回结果并重新发布
+	pub := paho.NewClient(paho.NewClientOptions().AddBroker(b.url()).SetClientID("test-pub"))
+	if tk := pub.Connect(); tk.Wait() && tk.Error() != nil {
+		t.Fatal(tk.Error())
+	}
+	defer pub.Disconnect(0)
+	pub.Publish("test/th01/setpoint/set", 0, false, `{"value": 25.5}`).Wait()
+	if err := json.Unmarshal(expect(t, msgs, "test/th01/setpoint"), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Value == nil || *payload.Value != 25.5 {
+		t.Fatalf("写入后发布的值不正确: %+v", payload)
+	}
+	if res := expect(t, msgs, "test/th01/setpoint/result"); string(res) != "ok" {
+		t.Fatalf("写入结果 %s，预期 ok", res)
+	}
+	fake.mu.Lock()
+	if v := fake.regs[10]; v != 255 {
+		t.Fatalf("寄存器的值 %d，预期 255", v)
+	}
+	fake.mu.Unlock()
+
+	// 无法解析的命令返回错误，不写入
+	pub.Publish("test/th01/setpoint/set", 0, false, "abc").Wait()
+	if res := expect(t, msgs, "test/th01/setpoint/result"); !strings.Contains(string(res), "无法解析") {
+		t.Fatalf("错误命令的结果 %s", res)
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	for payload, want := range map[string]float64{"1.5": 1.5, " on ": 1, "false": 0, `{"value": -2}`: -2} {
+		got, err := parseCommand([]byte(payload))
+		if err != nil || got != want {
+			t.Errorf("parseCommand(%q) = %v, %v，预期 %v", payload, got, err, want)
+		}
+	}
+	if _, err := parseCommand([]byte(`{"v": 1}`)); err == nil {
+		t.Error(`parseCommand({"v": 1}) 应该报错`)
+	}
+}
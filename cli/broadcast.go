@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+)
+
+// BroadcastId 广播站号，所有从站执行请求但都不响应。只用于串行链路（RTU），
+// 必须用 SetBroadcast 显式开启，RTU 下直接把站号设为 0 发送请求会返回错误；
+// Modbus TCP 中站号 0 用于访问服务器本身，按普通请求发送
+const BroadcastId = 0
+
+// DefaultTurnaroundDelay 广播后等待从站处理的默认时间
+const DefaultTurnaroundDelay = 100 * time.Millisecond
+
+// SetTurnaroundDelay 设置广播后等待的时间，0 使用默认值
+func (cli *client) SetTurnaroundDelay(d time.Duration) {
+	if d <= 0 {
+		d = DefaultTurnaroundDelay
+	}
+	cli.turnaround = d
+}
+
+// SetBroadcast 开启后写请求以站号 BroadcastId 广播，直到关闭为止，
+// 不改变 SlaveId。只有串行链路（RTU）支持广播
+func (cli *client) SetBroadcast(on bool) error {
+	if on && cli.protocol != ProtocolRTU {
+		return fmt.Errorf("modbus: %s 连接不支持广播", cli.protocol)
+	}
+	cli.broadcasting = on
+	return nil
+}
+
+// broadcast 发送广播请求，不等待响应，发送后等待 turnaround 让从站处理完。
+// 从站不响应广播，返回按请求构造的正常响应，调用方可以照常校验。
+// 广播不计入站点的健康状态。
+func (cli *client) broadcast(request *ProtocolDataUnit) (response *ProtocolDataUnit, err error) {
+	response = &ProtocolDataUnit{FunctionCode: request.FunctionCode, Data: request.Data}
+	switch request.FunctionCode {
+	case FuncCodeWriteSingleCoil,
+		FuncCodeWriteSingleRegister,
+		FuncCodeMaskWriteRegister,
+		FuncCodeWriteFileRecord:
+	case FuncCodeWriteMultipleCoils,
+		FuncCodeWriteMultipleRegisters:
+		// 响应为地址和数量
+		response.Data = request.Data[:4]
+	default:
+		return nil, fmt.Errorf("modbus: 功能码 '%v' 不支持广播", request.FunctionCode)
+	}
+	id := cli.slaveId
+	cli.slaveId = BroadcastId
+	adu, err := cli.packager.Encode(request)
+	cli.slaveId = id
+	if err != nil {
+		return nil, err
+	}
+	cli.logFrame(DirectionTX, adu, 0, nil)
+	if _, err = cli.port.Write(adu); err != nil {
+		return nil, err
+	}
+	time.Sleep(cli.turnaround)
+	return
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBroadcastIsExplicit(t *testing.T) {
+	var requests [][]byte
+	port := &loopbackPort{handler: func(functionCode byte, request []byte) ([]byte, error) {
+		requests = append(requests, request)
+		return request, nil
+	}}
+	c := newClient(&DefaultOptions().Mode, port, BroadcastId)
+	c.SetTurnaroundDelay(time.Millisecond)
+
+	// 站号 0 不能直接发送请求
+	if _, err := c.WriteSingleRegister(1, 2); err == nil {
+		t.Fatal("站号 0 没有开启广播时应该返回错误")
+	}
+	if len(requests) != 0 {
+		t.Fatalf("没有开启广播时不应该发送请求")
+	}
+
+	c.SetSlaveId(5)
+	if err := c.SetBroadcast(true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.WriteSingleRegister(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if c.SlaveId() != 5 || len(requests) != 1 {
+		t.Fatalf("站号 %v，请求 %v", c.SlaveId(), len(requests))
+	}
+	if _, err := c.ReadHoldingRegisters(1, 1); err == nil {
+		t.Fatal("读功能码不能广播")
+	}
+
+	tcp := newClient(&DefaultOptions().Mode, port, BroadcastId)
+	tcp.protocol = ProtocolTCP
+	if err := tcp.SetBroadcast(true); err == nil {
+		t.Fatal("TCP 连接不能广播")
+	}
+}
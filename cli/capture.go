@@ -0,0 +1,257 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrReplayEnd 回放的会话已经结束
+var ErrReplayEnd = errors.New("replay: 录制的会话已结束")
+
+// CaptureHeader 录制文件的第一行，描述录制时的连接
+type CaptureHeader struct {
+	Protocol string    `json:"protocol"`
+	Port     string    `json:"port"`
+	BaudRate int       `json:"baud,omitempty"`
+	Start    time.Time `json:"start"`
+}
+
+// CaptureEvent 端口上的一次读或写
+type CaptureEvent struct {
+	// At 相对录制开始的时间
+	At time.Duration `json:"at"`
+	// Op w 为写，r 为读
+	Op   string `json:"op"`
+	Data string `json:"data"`
+	// Duration 读操作等待的时间，Data 为空表示读超时
+	Duration time.Duration `json:"dur,omitempty"`
+}
+
+// CaptureWriter 把端口上每次读写的数据和时间按 JSON 行写入录制文件，
+// 之后可以用 ReplayPort 在没有硬件的情况下回放同一会话。
+//
+// 录制的是端口上的原始字节（包括分几次到达的半帧），
+// 所以回放时可以重现设备的各种异常行为。
+type CaptureWriter struct {
+	mu     sync.Mutex
+	enc    *json.Encoder
+	start  time.Time
+	header bool
+}
+
+// NewCaptureWriter 创建录制文件
+func NewCaptureWriter(w io.Writer) *CaptureWriter {
+	return &CaptureWriter{enc: json.NewEncoder(w), start: time.Now()}
+}
+
+// Wrap 返回录制 port 读写的 Port。同一个 CaptureWriter 可以录制先后打开的多个端口
+// （例如扫描时），文件头使用第一个端口的信息。
+func (cw *CaptureWriter) Wrap(port Port, header CaptureHeader) Port {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	if !cw.header {
+		header.Start = cw.start
+		_ = cw.enc.Encode(header)
+		cw.header = true
+	}
+	return &recordingPort{Port: port, cw: cw}
+}
+
+func (cw *CaptureWriter) record(e CaptureEvent) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	_ = cw.enc.Encode(e)
+}
+
+// recordingPort 记录读写的 Port
+type recordingPort struct {
+	Port
+	cw *CaptureWriter
+}
+
+func (r *recordingPort) Write(p []byte) (n int, err error) {
+	at := time.Since(r.cw.start)
+	n, err = r.Port.Write(p)
+	if n > 0 {
+		r.cw.record(CaptureEvent{At: at, Op: "w", Data: hex.EncodeToString(p[:n])})
+	}
+	return
+}
+
+func (r *recordingPort) Read(p []byte) (n int, err error) {
+	begin := time.Now()
+	n, err = r.Port.Read(p)
+	if err == nil || n > 0 {
+		r.cw.record(CaptureEvent{
+			At:       begin.Sub(r.cw.start),
+			Op:       "r",
+			Data:     hex.EncodeToString(p[:n]),
+			Duration: time.Since(begin),
+		})
+	}
+	return
+}
+
+// Name 返回被录制端口的名称
+func (r *recordingPort) Name() string {
+	return portName(r.Port)
+}
+
+// Unwrap 返回被录制的端口
+func (r *recordingPort) Unwrap() Port {
+	return r.Port
+}
+
+// unwrapPort 去掉录制等包装，返回最底层的端口
+func unwrapPort(port Port) Port {
+	for {
+		w, ok := port.(interface{ Unwrap() Port })
+		if !ok {
+			return port
+		}
+		port = w.Unwrap()
+	}
+}
+
+// Capture 读取到内存中的录制文件
+type Capture struct {
+	Header CaptureHeader
+	Events []CaptureEvent
+}
+
+// LoadCapture 读取录制文件
+func LoadCapture(path string) (c *Capture, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return ReadCapture(f)
+}
+
+// ReadCapture 从 r 读取录制文件
+func ReadCapture(r io.Reader) (c *Capture, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), 1<<20)
+	c = &Capture{}
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		if line == 1 {
+			err = json.Unmarshal(text, &c.Header)
+		} else {
+			var e CaptureEvent
+			if err = json.Unmarshal(text, &e); err == nil {
+				_, err = hex.DecodeString(e.Data)
+			}
+			c.Events = append(c.Events, e)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("录制文件第 %d 行: %w", line, err)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if line == 0 {
+		return nil, errors.New("录制文件为空")
+	}
+	return
+}
+
+// ReplayPort 按录制文件回放的假端口，实现 Port 接口。
+// 写入的数据必须与录制的请求一致，读取时依次返回录制的响应片段。
+type ReplayPort struct {
+	// Realtime 为 true 时按录制时的耗时等待，否则立即返回
+	Realtime bool
+
+	mu      sync.Mutex
+	capture *Capture
+	next    int
+}
+
+// NewReplayPort 创建回放端口
+func NewReplayPort(c *Capture) *ReplayPort {
+	return &ReplayPort{capture: c}
+}
+
+// Name 返回录制时的端口名
+func (p *ReplayPort) Name() string {
+	return p.capture.Header.Port
+}
+
+// Protocol 返回录制时的帧格式
+func (p *ReplayPort) Protocol() string {
+	if p.capture.Header.Protocol == "" {
+		return ProtocolRTU
+	}
+	return p.capture.Header.Protocol
+}
+
+func (p *ReplayPort) Write(b []byte) (n int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// 跳过客户端没有读完的响应
+	for p.next < len(p.capture.Events) && p.capture.Events[p.next].Op == "r" {
+		p.next++
+	}
+	if p.next >= len(p.capture.Events) {
+		return 0, ErrReplayEnd
+	}
+	e := p.capture.Events[p.next]
+	p.next++
+	if want := e.Data; want != hex.EncodeToString(b) {
+		return 0, fmt.Errorf("replay: 第 %d 个事件，请求 % X 与录制的 %s 不一致", p.next, b, want)
+	}
+	return len(b), nil
+}
+
+func (p *ReplayPort) Read(b []byte) (n int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.next >= len(p.capture.Events) {
+		return 0, ErrReplayEnd
+	}
+	e := p.capture.Events[p.next]
+	if e.Op != "r" {
+		// 录制时这里已经没有数据了，按超时处理。
+		// 串口超时返回 0 字节，TCP 超时返回错误
+		if p.Protocol() == ProtocolTCP {
+			return 0, os.ErrDeadlineExceeded
+		}
+		return 0, nil
+	}
+	data, _ := hex.DecodeString(e.Data)
+	if len(data) > len(b) {
+		// 缓冲区不够时分几次返回
+		n = copy(b, data)
+		p.capture.Events[p.next].Data = hex.EncodeToString(data[n:])
+		return
+	}
+	p.next++
+	if p.Realtime {
+		time.Sleep(e.Duration)
+	}
+	n = copy(b, data)
+	return
+}
+
+func (p *ReplayPort) SetReadTimeout(t time.Duration) error {
+	return nil
+}
+
+func (p *ReplayPort) Close() error {
+	return nil
+}
@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// replayClient 用录制文件创建回放客户端
+func replayClient(t *testing.T, path string) Client {
+	t.Helper()
+	capture, err := LoadCapture(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultOptions()
+	opts.Replay = NewReplayPort(capture)
+	c, err := NewClient(opts, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestReplaySplitAndTruncatedFrames(t *testing.T) {
+	c := replayClient(t, "testdata/split.jsonl")
+	defer c.Close()
+
+	// 响应分两次到达
+	res, err := c.ReadHoldingRegisters(1, 2)
+	if err != nil {
+		t.Fatalf("分段响应: %v", err)
+	}
+	if want := []byte{0x00, 0x0A, 0x00, 0x14}; !bytes.Equal(res, want) {
+		t.Fatalf("分段响应 % X，预期 % X", res, want)
+	}
+
+	// 响应只收到一半，之后超时
+	if _, err = c.ReadHoldingRegisters(3, 1); err == nil || !strings.Contains(err.Error(), "响应不完整") {
+		t.Fatalf("不完整的响应应该报错，得到 %v", err)
+	}
+
+	// 之后的请求不受上一帧影响
+	res, err = c.ReadHoldingRegisters(4, 1)
+	if err != nil {
+		t.Fatalf("不完整响应之后的请求: %v", err)
+	}
+	if want := []byte{0x00, 0xFF}; !bytes.Equal(res, want) {
+		t.Fatalf("响应 % X，预期 % X", res, want)
+	}
+}
+
+func TestReplayMismatchedRequest(t *testing.T) {
+	c := replayClient(t, "testdata/split.jsonl")
+	defer c.Close()
+	if _, err := c.ReadHoldingRegisters(2, 2); err == nil || !strings.Contains(err.Error(), "不一致") {
+		t.Fatalf("与录制不同的请求应该报错，得到 %v", err)
+	}
+}
+
+// scriptedPort 按顺序返回预设的读取片段，片段用完后按超时处理
+type scriptedPort struct {
+	reads  [][]byte
+	writes [][]byte
+}
+
+func (p *scriptedPort) Write(b []byte) (int, error) {
+	p.writes = append(p.writes, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func (p *scriptedPort) Read(b []byte) (int, error) {
+	if len(p.reads) == 0 {
+		return 0, nil
+	}
+	n := copy(b, p.reads[0])
+	p.reads = p.reads[1:]
+	return n, nil
+}
+
+func (p *scriptedPort) SetReadTimeout(t time.Duration) error { return nil }
+func (p *scriptedPort) Close() error                         { return nil }
+
+func TestRecordThenReplay(t *testing.T) {
+	var buf bytes.Buffer
+	cw := NewCaptureWriter(&buf)
+	port := &scriptedPort{reads: [][]byte{
+		{0x01, 0x03, 0x04},
+		{0x00, 0x0A, 0x00, 0x14, 0xDA, 0x3E},
+	}}
+	recorded := cw.Wrap(port, CaptureHeader{Protocol: ProtocolRTU, Port: "fake"})
+	if unwrapPort(recorded) != Port(port) {
+		t.Fatal("unwrapPort 没有返回被录制的端口")
+	}
+	c := newClient(&DefaultOptions().Mode, recorded, 1)
+	want, err := c.ReadHoldingRegisters(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	capture, err := ReadCapture(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if capture.Header.Port != "fake" || len(capture.Events) != 3 {
+		t.Fatalf("录制内容不正确: %+v", capture)
+	}
+	c = newClient(&DefaultOptions().Mode, NewReplayPort(capture), 1)
+	got, err := c.ReadHoldingRegisters(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("回放结果 % X，录制时 % X", got, want)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"go-oak/util"
 	"go.bug.st/serial"
 	"log"
+	"net"
 	"time"
 )
 
@@ -14,6 +15,7 @@ const (
 	rtuMaxSize       = 256
 	rtuExceptionSize = 5
 	numSlavesScan    = 20
+	replugTimeout    = 2 * time.Minute
 )
 
 // NewClientDefault 根据给定的参数创建一个 modbus client.
@@ -25,57 +27,42 @@ func NewClientDefault(mode *serial.Mode, salveId byte) Client {
 		log.Fatal("连接失败")
 		return nil
 	}
-	return &client{*mode, port, salveId}
+	return newClient(mode, port, salveId)
 }
 
-func NewClient(slaveId byte) (cli Client, err error) {
-	// 定义 Mode
-	mode := &serial.Mode{
-		BaudRate: 9600,
-		Parity:   serial.NoParity,
-		DataBits: 8,
-		StopBits: serial.OneStopBit,
-	}
-	// 寻找可用串口并连接
-	port, err := util.ConnectDefault(mode)
-	if err = port.SetReadTimeout(time.Second); err != nil {
-		log.Fatal("连接失败")
-		return
+// NewClient 按连接参数连接串口或 Modbus TCP 服务器
+func NewClient(opts *Options, slaveId byte) (Client, error) {
+	cli, err := openClient(opts, "", slaveId)
+	if err != nil {
+		return nil, err
 	}
-	cli = &client{*mode, port, slaveId}
-	return
+	return cli, nil
 }
 
 func CustomClient(mode *serial.Mode, portName string) (cli Client, err error) {
-	port, err := serial.Open(portName, mode)
+	port, err := util.OpenReconnect(portName, mode)
 	if err != nil {
 		return
 	}
-	cli = &client{*mode, port, 0}
+	cli = newClient(mode, port, 0)
 	return
 }
 
-func TempHumClient() (client Client, err error) {
-	// 定义 Mode
-	mode := &serial.Mode{
-		BaudRate: 9600,
-		Parity:   serial.NoParity,
-		DataBits: 8,
-		StopBits: serial.OneStopBit,
-	}
-	ports, err := util.GetPorts()
+// TempHumClient 按连接参数扫描可以响应温湿度的站
+func TempHumClient(opts *Options) (client Client, err error) {
+	targets, err := scanTargets(opts)
 	if err != nil {
 		log.Fatal(err)
 	}
-	for i := range ports {
-		client, err = CustomClient(mode, ports[i])
+	for _, target := range targets {
+		client, err = openTarget(opts, target)
 		if err != nil {
-			log.Printf("端口%s被占用\n", ports[i])
+			log.Printf("端口%s被占用\n", target)
 			continue
 		}
-		for id := 1; id <= numSlavesScan; id++ {
+		for id := int(opts.ScanFrom); id <= int(opts.ScanTo); id++ {
 			if err = client.Try(byte(id)); err == nil {
-				log.Printf("连接 站号%02d@端口%s 成功", id, ports[i])
+				log.Printf("连接 站号%02d@端口%s 成功", id, target)
 				return
 			}
 		}
@@ -83,6 +70,91 @@ func TempHumClient() (client Client, err error) {
 	return
 }
 
+// scanTargets 返回需要扫描的端口名，TCP 连接时返回服务器地址
+func scanTargets(opts *Options) ([]string, error) {
+	switch {
+	case opts.Replay != nil:
+		return []string{opts.Replay.Name()}, nil
+	case opts.IsTCP():
+		return []string{opts.Address}, nil
+	}
+	return scanPorts(opts.Port)
+}
+
+// openTarget 打开 scanTargets 返回的端口或服务器
+func openTarget(opts *Options, target string) (Client, error) {
+	cli, err := openClient(opts, target, 0)
+	if err != nil {
+		return nil, err
+	}
+	return cli, nil
+}
+
+// openClient 按连接参数打开端口并创建客户端。target 为空时按 opts 中的选择器或地址连接，
+// 设置了 Replay 时使用回放端口，设置了 Record 时录制端口上的读写。
+func openClient(opts *Options, target string, slaveId byte) (cli *client, err error) {
+	var port Port
+	protocol := ProtocolRTU
+	switch {
+	case opts.Replay != nil:
+		port = opts.Replay
+		protocol = opts.Replay.Protocol()
+	case opts.IsTCP():
+		if target == "" {
+			target = opts.Address
+		}
+		conn, err := net.DialTimeout("tcp", target, opts.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		port = &tcpPort{Conn: conn}
+		protocol = ProtocolTCP
+	case target == "":
+		// 寻找可用串口并连接
+		if port, err = util.Connect(opts.Port, &opts.Mode); err != nil {
+			return
+		}
+	default:
+		if port, err = util.OpenReconnect(target, &opts.Mode); err != nil {
+			return
+		}
+	}
+	if opts.Record != nil {
+		header := CaptureHeader{Protocol: protocol, Port: portName(port)}
+		if protocol == ProtocolRTU {
+			header.BaudRate = opts.Mode.BaudRate
+		}
+		port = opts.Record.Wrap(port, header)
+	}
+	if protocol == ProtocolTCP {
+		cli = newTCPClient(port, opts.Timeout, slaveId)
+	} else {
+		cli = newClient(&opts.Mode, port, slaveId)
+		if opts.Timeout > 0 {
+			cli.timeout = opts.Timeout
+		}
+	}
+	cli.SetFrameLogger(opts.FrameLogger)
+	cli.SetTurnaroundDelay(opts.TurnaroundDelay)
+	return
+}
+
+// scanPorts 返回需要扫描的端口名，选择器为空时扫描所有端口
+func scanPorts(selector string) (names []string, err error) {
+	if selector == "" {
+		return util.GetPorts()
+	}
+	ports, err := util.FindPorts(selector)
+	if err != nil {
+		return
+	}
+	for _, p := range ports {
+		log.Printf("找到端口: %v\n", p)
+		names = append(names, p.Name)
+	}
+	return
+}
+
 func (cli *client) Try(id byte) (err error) {
 	cli.SetSlaveId(id)
 	_, err = cli.ReadInputRegisters(1, 1)
@@ -92,41 +164,31 @@ func (cli *client) Try(id byte) (err error) {
 	return
 }
 
-func ChangeSlaveId() {
-	// 定义 Mode
-	mode := &serial.Mode{
-		BaudRate: 9600,
-		Parity:   serial.NoParity,
-		DataBits: 8,
-		StopBits: serial.OneStopBit,
-	}
-	ports, err := util.GetPorts()
+// ChangeSlaveId 按连接参数扫描站号并交互式更改
+func ChangeSlaveId(opts *Options) {
+	ports, err := scanTargets(opts)
 	if err != nil {
 		log.Fatal(err)
 	}
 	for i := range ports {
-		client, err := CustomClient(mode, ports[i])
+		client, err := openTarget(opts, ports[i])
 		if err != nil {
 			log.Println("端口被占用")
 			continue
 		}
 		exit := false
 		skip := make(map[uint16]bool)
-		for id := 1; id <= numSlavesScan; id++ {
+		for id := int(opts.ScanFrom); id <= int(opts.ScanTo); id++ {
 			if err = client.Try(byte(id)); !skip[uint16(id)] && err == nil {
 				log.Printf("连接 站号%02d@端口%s 成功", id, ports[i])
 				fmt.Println("输入想要更改的站号( 输入`0`不更改继续扫描 ):")
 				var to uint16
 				_, _ = fmt.Scanln(&to)
 				if to != 0 {
-					_, err = client.WriteSingleRegister(257, to)
-					log.Println("更改成功，请重新插拔设备，按回车继续.")
-					if err = client.Close(); err != nil {
-						log.Fatal("Close client failed")
-					}
-					_, _ = fmt.Scanln(&to)
+					_, err = client.WriteSingleRegister(opts.SlaveIdRegister, to)
+					waitReplug(client)
 					client.SetSlaveId(byte(to))
-					res, _ := client.ReadHoldingRegisters(257, 1)
+					res, _ := client.ReadHoldingRegisters(opts.SlaveIdRegister, 1)
 					change, _ := util.BytesToIntU(res)
 					log.Printf("寄存器中站号：%d", change)
 					if change == int(to) {
@@ -155,17 +217,116 @@ func ChangeSlaveId() {
 	}
 }
 
+// waitReplug 提示用户重新插拔设备，等待设备重新连接
+func waitReplug(c Client) {
+	if cl, ok := c.(*client); ok {
+		// --record 时端口被录制包装，需要取出底层端口
+		if rp, ok := unwrapPort(cl.port).(*util.ReconnectPort); ok {
+			log.Println("更改成功，请重新插拔设备...")
+			if err := rp.WaitReplug(replugTimeout); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+	log.Println("更改成功，请重新插拔设备，按回车继续.")
+	_, _ = fmt.Scanln()
+}
+
 // client 实现 Client 接口
 type client struct {
 	serial.Mode
-	port    serial.Port
+	port    Port
 	slaveId byte
+	health  *healthTracker
+
+	// packager 和 transporter 默认为 client 自身（RTU），TCP 时为 tcpTransporter
+	packager    Packager
+	transporter Transporter
+	protocol    string
+	logger      FrameLogger
+	// turnaround 广播后等待从站处理的时间
+	turnaround time.Duration
+	// broadcasting 由 SetBroadcast 开启，请求以广播发送
+	broadcasting bool
+	// timeout 串口上请求和响应传输完后等待从站响应的时间
+	timeout time.Duration
+	// functions 注册的自定义功能码
+	functions map[byte]*Function
+}
+
+func newClient(mode *serial.Mode, port Port, slaveId byte) *client {
+	cli := &client{
+		Mode:    *mode,
+		port:    port,
+		slaveId: slaveId,
+		health:  newHealthTracker(DefaultHealthPolicy),
+		timeout: DefaultTimeout,
+
+		turnaround: DefaultTurnaroundDelay,
+	}
+	cli.packager = cli
+	cli.transporter = cli
+	cli.protocol = ProtocolRTU
+	return cli
+}
+
+func (cli *client) SetFrameLogger(logger FrameLogger) {
+	cli.logger = logger
+}
+
+// PortName 返回当前的串口名或 TCP 服务器地址
+func (cli *client) PortName() string {
+	return portName(cli.port)
+}
+
+func portName(port Port) string {
+	switch p := port.(type) {
+	case interface{ Name() string }:
+		return p.Name()
+	case *tcpPort:
+		return p.RemoteAddr().String()
+	}
+	return ""
+}
+
+// logFrame 把收发的帧交给 FrameLogger
+func (cli *client) logFrame(direction Direction, adu []byte, latency time.Duration, err error) {
+	if cli.logger == nil {
+		return
+	}
+	cli.logger.LogFrame(&Frame{
+		Direction: direction,
+		Time:      time.Now(),
+		Port:      cli.PortName(),
+		Protocol:  cli.protocol,
+		Raw:       adu,
+		Summary:   SummarizeADU(cli.protocol, adu, direction == DirectionTX),
+		Latency:   latency,
+		Err:       err,
+	})
+}
+
+// Health 返回通信过的所有站点的健康状态
+func (cli *client) Health() []StationHealth {
+	return cli.health.snapshot()
+}
+
+// SetHealthPolicy 设置熔断策略，已有的统计保留
+func (cli *client) SetHealthPolicy(policy HealthPolicy) {
+	cli.health.mu.Lock()
+	cli.health.policy = policy
+	cli.health.mu.Unlock()
 }
 
 func (cli *client) SetSlaveId(id byte) {
 	cli.slaveId = id
 }
 
+func (cli *client) SlaveId() byte {
+	return cli.slaveId
+}
+
 func (cli *client) String() string {
 	return "Slave ID " + string(cli.slaveId)
 }
@@ -206,6 +367,11 @@ func (cli *client) Verify(aduRequest []byte, aduResponse []byte) (err error) {
 	return
 }
 
+// Decode 实现 Packager 接口
+func (cli *client) Decode(adu []byte) (pdu *ProtocolDataUnit, err error) {
+	return Decode(adu)
+}
+
 // Decode 从帧中提取 PDU 并对比 checksum 是否匹配，最后返回 PDU。
 func Decode(adu []byte) (pdu *ProtocolDataUnit, err error) {
 	length := len(adu)
@@ -213,7 +379,7 @@ func Decode(adu []byte) (pdu *ProtocolDataUnit, err error) {
 	realChecksum := util.CheckSum(adu[0 : length-2])
 	checksum := uint16(adu[length-1])<<8 | uint16(adu[length-2])
 	if checksum != realChecksum {
-		err = fmt.Errorf("modbus: response crc '%v' does not match expected '%v'", checksum, realChecksum)
+		err = fmt.Errorf("%w: response crc '%v' does not match expected '%v'", ErrChecksum, checksum, realChecksum)
 		return
 	}
 	// 功能码和数据封装
@@ -226,25 +392,38 @@ func Decode(adu []byte) (pdu *ProtocolDataUnit, err error) {
 
 // send 发送 PDU，返回响应的 PDU
 func (cli *client) send(request *ProtocolDataUnit) (response *ProtocolDataUnit, err error) {
-	adu, err := cli.Encode(request)
-	request.Data[0] = cli.slaveId
+	id := cli.slaveId
+	if cli.broadcasting {
+		return cli.broadcast(request)
+	}
+	if id == BroadcastId && cli.protocol == ProtocolRTU {
+		err = fmt.Errorf("modbus: 站号 '%v' 为广播地址，广播请用 SetBroadcast 显式开启", id)
+		return
+	}
+	if err = cli.health.allow(id); err != nil {
+		return
+	}
+	defer func() { cli.health.record(id, err) }()
+	adu, err := cli.packager.Encode(request)
 	if err != nil {
 		return
 	}
-	aduResponse, err := cli.Send(adu)
+	start := time.Now()
+	cli.logFrame(DirectionTX, adu, 0, nil)
+	aduResponse, err := cli.transporter.Send(adu)
+	if err == nil {
+		if err = cli.packager.Verify(adu, aduResponse); err == nil {
+			response, err = cli.packager.Decode(aduResponse)
+		}
+	}
+	cli.logFrame(DirectionRX, aduResponse, time.Since(start), err)
 	if err != nil {
-		//log.Println(err, "From send()")
 		return
 	}
-	response, err = Decode(aduResponse)
 	if response.FunctionCode != request.FunctionCode { // 发送与响应功能码不同
 		err = responseError(response)
 		return
 	}
-	if err != nil {
-		log.Println(err)
-		return
-	}
 	if response.Data == nil || len(response.Data) == 0 {
 		err = fmt.Errorf("modbus: 无数据响应")
 		return
@@ -252,40 +431,53 @@ func (cli *client) send(request *ProtocolDataUnit) (response *ProtocolDataUnit,
 	return
 }
 
-// Send 发送帧，返回响应的帧
+// Send 发送帧，返回响应的帧。
+// 响应可能分几次到达，一直读到预期长度或超时为止，不完整的帧返回错误。
 func (cli *client) Send(aduRequest []byte) (aduResponse []byte, err error) {
 	if _, err = cli.port.Write(aduRequest); err != nil {
 		return
 	}
-	//log.Printf("TX:% X \n", aduRequest)
 	functionalCode := aduRequest[1]
-	functionFail := aduRequest[1] & 0x80
-	bytesToRead := calculateResponseLength(aduRequest)
-	delay := cli.calculateDelay((len(aduRequest) + bytesToRead) * int(aduRequest[1]))
+	functionFail := aduRequest[1] | 0x80
+	bytesToRead := cli.expectedLength(aduRequest, nil, calculateResponseLength(aduRequest))
+	// 先等请求和响应按波特率传输完，之后每次读取最多再等从站响应的超时
+	delay := cli.calculateDelay(len(aduRequest) + bytesToRead)
 	time.Sleep(delay)
 	data := make([]byte, rtuMaxSize)
 
-	// 先读最小的长度，如果无错再读完
-	err = cli.port.SetReadTimeout(delay)
-	n, err := cli.port.Read(data[:])
+	if err = cli.port.SetReadTimeout(delay + cli.timeout); err != nil {
+		return
+	}
+	n := 0
+	for n < bytesToRead {
+		var m int
+		if m, err = cli.port.Read(data[n:]); err != nil {
+			return
+		}
+		if m == 0 { // 超时
+			break
+		}
+		n += m
+		if bytesToRead = cli.expectedLength(aduRequest, data[:n], bytesToRead); bytesToRead > rtuMaxSize {
+			bytesToRead = rtuMaxSize
+		}
+	}
 	if n == 0 {
 		err = &ModbusError{
 			FunctionCode:  aduRequest[1],
 			ExceptionCode: ExceptionCodeGatewayTargetDeviceFailedToRespond}
 		return
 	}
-	if data[1] == functionalCode {
-		aduResponse = data[:n]
-	} else if data[1] == functionFail {
-		// 串口返回错误码
-		aduRequest = data[:rtuExceptionSize]
-	} else {
-		err = fmt.Errorf("无响应数据")
+	if n < 2 || (data[1] != functionalCode && data[1] != functionFail) {
+		err = fmt.Errorf("modbus: 无法识别的响应 % X", data[:n])
 		return
 	}
-	if err != nil {
+	if n < bytesToRead {
+		err = fmt.Errorf("modbus: 响应不完整，收到 '%v' 字节，预期 '%v' 字节", n, bytesToRead)
 		return
 	}
+	// 多出来的字节不属于这一帧
+	aduResponse = data[:bytesToRead]
 	return
 }
 
@@ -357,28 +549,150 @@ func (cli *client) WriteSingleRegister(address, value uint16) (results []byte, e
 }
 
 func (cli *client) ReadCoils(address, quantity uint16) (results []byte, err error) {
-	//TODO implement me
-	panic("implement me")
+	if quantity < 1 || quantity > 2000 {
+		err = fmt.Errorf("modbus: 数量 '%v' 必须在 '%v' 和 '%v' 之间", quantity, 1, 2000)
+		return
+	}
+	request := ProtocolDataUnit{
+		FunctionCode: FuncCodeReadCoils,
+		Data:         dataBlock(address, quantity),
+	}
+	response, err := cli.send(&request)
+	if err != nil {
+		return
+	}
+	count := int(response.Data[0])
+	length := len(response.Data) - 1
+	if count != length {
+		err = fmt.Errorf("modbus: 响应长度 '%v' 不匹配实际接收长度 '%v'", length, count)
+		return
+	}
+	results = response.Data[1:]
+	return
 }
 
 func (cli *client) ReadDiscreteInputs(address, quantity uint16) (results []byte, err error) {
-	//TODO implement me
-	panic("implement me")
+	if quantity < 1 || quantity > 2000 {
+		err = fmt.Errorf("modbus: 数量 '%v' 必须在 '%v' 和 '%v' 之间", quantity, 1, 2000)
+		return
+	}
+	request := ProtocolDataUnit{
+		FunctionCode: FuncCodeReadDiscreteInputs,
+		Data:         dataBlock(address, quantity),
+	}
+	response, err := cli.send(&request)
+	if err != nil {
+		return
+	}
+	count := int(response.Data[0])
+	length := len(response.Data) - 1
+	if count != length {
+		err = fmt.Errorf("modbus: 响应长度 '%v' 不匹配实际接收长度 '%v'", length, count)
+		return
+	}
+	results = response.Data[1:]
+	return
 }
 
+// WriteSingleCoil value 只能是 0xFF00（ON）或 0x0000（OFF）
 func (cli *client) WriteSingleCoil(address, value uint16) (results []byte, err error) {
-	//TODO implement me
-	panic("implement me")
+	if value != 0xFF00 && value != 0x0000 {
+		err = fmt.Errorf("modbus: 线圈状态 '%v' 必须是 0xFF00 或 0x0000", value)
+		return
+	}
+	request := ProtocolDataUnit{
+		FunctionCode: FuncCodeWriteSingleCoil,
+		Data:         dataBlock(address, value),
+	}
+	response, err := cli.send(&request)
+	if err != nil {
+		return
+	}
+	if len(response.Data) != 4 {
+		err = fmt.Errorf("modbus: 响应长度 '%v' 与预期接收长度 '%v' 不匹配", len(response.Data), 4)
+		return
+	}
+	respValue := binary.BigEndian.Uint16(response.Data)
+	if address != respValue {
+		err = fmt.Errorf("modbus: 响应 Address '%v' 与实际接收 Address '%v' 不匹配", respValue, address)
+		return
+	}
+	results = response.Data[2:]
+	respValue = binary.BigEndian.Uint16(results)
+	if value != respValue {
+		err = fmt.Errorf("modbus: 响应值 '%v' 与实际接收值 '%v' 不匹配", respValue, value)
+		return
+	}
+	return
 }
 
 func (cli *client) WriteMultipleCoils(address, quantity uint16, value []byte) (results []byte, err error) {
-	//TODO implement me
-	panic("implement me")
+	if quantity < 1 || quantity > 1968 {
+		err = fmt.Errorf("modbus: 数量 '%v' 必须在 '%v' 和 '%v' 之间", quantity, 1, 1968)
+		return
+	}
+	if len(value) != (int(quantity)+7)/8 {
+		err = fmt.Errorf("modbus: 数据长度 '%v' 与线圈数量 '%v' 不匹配", len(value), quantity)
+		return
+	}
+	request := ProtocolDataUnit{
+		FunctionCode: FuncCodeWriteMultipleCoils,
+		Data:         dataBlockSuffix(value, address, quantity),
+	}
+	response, err := cli.send(&request)
+	if err != nil {
+		return
+	}
+	results, err = verifyWriteMultiple(response, address, quantity)
+	return
 }
 
 func (cli *client) WriteMultipleRegisters(address, quantity uint16, value []byte) (results []byte, err error) {
-	//TODO implement me
-	panic("implement me")
+	if quantity < 1 || quantity > 123 {
+		err = fmt.Errorf("modbus: 数量 '%v' 必须在 '%v' 和 '%v' 之间", quantity, 1, 123)
+		return
+	}
+	if len(value) != int(quantity)*2 {
+		err = fmt.Errorf("modbus: 数据长度 '%v' 与寄存器数量 '%v' 不匹配", len(value), quantity)
+		return
+	}
+	request := ProtocolDataUnit{
+		FunctionCode: FuncCodeWriteMultipleRegisters,
+		Data:         dataBlockSuffix(value, address, quantity),
+	}
+	response, err := cli.send(&request)
+	if err != nil {
+		return
+	}
+	results, err = verifyWriteMultiple(response, address, quantity)
+	return
+}
+
+func (cli *client) MaskWriteRegister(address, andMask, orMask uint16) (results []byte, err error) {
+	request := ProtocolDataUnit{
+		FunctionCode: FuncCodeMaskWriteRegister,
+		Data:         dataBlock(address, andMask, orMask),
+	}
+	response, err := cli.send(&request)
+	if err != nil {
+		return
+	}
+	// 响应与请求相同
+	if len(response.Data) != 6 {
+		err = fmt.Errorf("modbus: 响应长度 '%v' 与预期接收长度 '%v' 不匹配", len(response.Data), 6)
+		return
+	}
+	respValue := binary.BigEndian.Uint16(response.Data)
+	if address != respValue {
+		err = fmt.Errorf("modbus: 响应 Address '%v' 与实际接收 Address '%v' 不匹配", respValue, address)
+		return
+	}
+	results = response.Data[2:]
+	if and, or := binary.BigEndian.Uint16(results), binary.BigEndian.Uint16(results[2:]); and != andMask || or != orMask {
+		err = fmt.Errorf("modbus: 响应掩码 '%04X/%04X' 与请求掩码 '%04X/%04X' 不匹配", and, or, andMask, orMask)
+		return
+	}
+	return
 }
 
 func (cli *client) ReadWriteMultipleRegisters(readAddress, readQuantity, writeAddress, writeQuantity uint16, value []byte) (results []byte, err error) {
@@ -386,6 +700,26 @@ func (cli *client) ReadWriteMultipleRegisters(readAddress, readQuantity, writeAd
 	panic("implement me")
 }
 
+// verifyWriteMultiple 检查批量写入的响应地址和数量是否与请求一致
+func verifyWriteMultiple(response *ProtocolDataUnit, address, quantity uint16) (results []byte, err error) {
+	if len(response.Data) != 4 {
+		err = fmt.Errorf("modbus: 响应长度 '%v' 与预期接收长度 '%v' 不匹配", len(response.Data), 4)
+		return
+	}
+	respValue := binary.BigEndian.Uint16(response.Data)
+	if address != respValue {
+		err = fmt.Errorf("modbus: 响应 Address '%v' 与实际接收 Address '%v' 不匹配", respValue, address)
+		return
+	}
+	results = response.Data[2:]
+	respValue = binary.BigEndian.Uint16(results)
+	if quantity != respValue {
+		err = fmt.Errorf("modbus: 响应数量 '%v' 与实际写入数量 '%v' 不匹配", respValue, quantity)
+		return
+	}
+	return
+}
+
 func (cli *client) Close() (cErr error) {
 	cErr = cli.port.Close()
 	if cErr != nil {
@@ -403,6 +737,18 @@ func dataBlock(value ...uint16) []byte {
 	return data
 }
 
+// dataBlockSuffix 把 uint16 数组转换为 byte 数组，后接字节数和 suffix
+func dataBlockSuffix(suffix []byte, value ...uint16) []byte {
+	length := 2 * len(value)
+	data := make([]byte, length+1+len(suffix))
+	for i, v := range value {
+		binary.BigEndian.PutUint16(data[i*2:], v)
+	}
+	data[length] = uint8(len(suffix))
+	copy(data[length+1:], suffix)
+	return data
+}
+
 // 计算应该响应数据的长度
 func calculateResponseLength(adu []byte) int {
 	length := rtuMinSize
@@ -423,11 +769,85 @@ func calculateResponseLength(adu []byte) int {
 		FuncCodeWriteSingleRegister,
 		FuncCodeWriteMultipleRegisters:
 		length += 4
+	case FuncCodeMaskWriteRegister:
+		length += 6
+	case FuncCodeReadFIFOQueue:
+		// 字节数和 FIFO 计数各两个字节，寄存器值按字节数计算
+		length += 4
+	case FuncCodeReadFileRecord:
+		length++
+	case FuncCodeWriteFileRecord:
+		// 写文件记录的响应与请求相同
+		length = len(adu)
+	case FuncCodeReadExceptionStatus:
+		length++
+	case FuncCodeReportServerId:
+		// 字节数、至少一个字节的 ID 和运行状态，其余按字节数计算
+		length += 1 + 2
+	case FuncCodeDiagnostics:
+		// 诊断的响应与请求等长
+		length = len(adu)
+	case FuncCodeGetCommEventCounter:
+		length += 4
+	case FuncCodeGetCommEventLog:
+		// 字节数、状态、事件计数和报文计数，事件按字节数计算
+		length += 1 + 6
+	case FuncCodeEncapsulatedInterface:
+		// 读设备标识：对象列表之前的部分，对象的长度在收到后再计算
+		length += deviceIdHeaderSize - 1
 	default:
 	}
 	return length
 }
 
+// responseLength 根据已收到的部分响应修正预期长度：
+// 异常响应固定长度，带字节数的响应按字节数计算。
+func responseLength(aduRequest, partial []byte, expected int) int {
+	if len(partial) < 2 {
+		return expected
+	}
+	if partial[1] == aduRequest[1]|0x80 {
+		return rtuExceptionSize
+	}
+	switch aduRequest[1] {
+	case FuncCodeReadCoils,
+		FuncCodeReadDiscreteInputs,
+		FuncCodeReadInputRegisters,
+		FuncCodeReadHoldingRegisters,
+		FuncCodeGetCommEventLog,
+		FuncCodeReportServerId,
+		FuncCodeReadFileRecord:
+		if len(partial) >= 3 {
+			return rtuMinSize + 1 + int(partial[2])
+		}
+	case FuncCodeReadFIFOQueue:
+		if len(partial) >= 4 {
+			return rtuMinSize + 2 + int(binary.BigEndian.Uint16(partial[2:]))
+		}
+	case FuncCodeEncapsulatedInterface:
+		return deviceIdResponseLength(partial, expected)
+	}
+	return expected
+}
+
+// deviceIdResponseLength 按已收到的对象计算读设备标识响应的长度，
+// 对象未收全时返回至少还需要的长度
+func deviceIdResponseLength(partial []byte, expected int) int {
+	// 从站号 + 对象列表之前的 PDU
+	offset := 1 + deviceIdHeaderSize
+	if len(partial) < offset {
+		return expected
+	}
+	count := int(partial[offset-1])
+	for i := 0; i < count; i++ {
+		if offset+2 > len(partial) {
+			return offset + 2 + 2
+		}
+		offset += 2 + int(partial[offset+1])
+	}
+	return offset + 2
+}
+
 // calculateDelay 简单计算等待响应的时间
 // See MODBUS over Serial Line - Specification and Implementation Guide (page 13).
 func (cli *client) calculateDelay(chars int) time.Duration {
@@ -0,0 +1,271 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// MEITypeReadDeviceIdentification 读设备标识的 MEI 类型
+const MEITypeReadDeviceIdentification = 0x0E
+
+// 读设备标识的访问类型（Read Device ID code）
+const (
+	ReadDeviceIdBasic      = 1 // 流式读取基本对象 0x00-0x02
+	ReadDeviceIdRegular    = 2 // 流式读取常规对象 0x00-0x7F
+	ReadDeviceIdExtended   = 3 // 流式读取扩展对象 0x00-0xFF
+	ReadDeviceIdIndividual = 4 // 读取单个对象
+)
+
+// 设备标识对象
+const (
+	ObjectIdVendorName          = 0x00
+	ObjectIdProductCode         = 0x01
+	ObjectIdMajorMinorRevision  = 0x02
+	ObjectIdVendorUrl           = 0x03
+	ObjectIdProductName         = 0x04
+	ObjectIdModelName           = 0x05
+	ObjectIdUserApplicationName = 0x06
+)
+
+const (
+	// deviceIdHeaderSize 响应 PDU 中对象列表之前的长度：功能码、MEI 类型、访问类型、
+	// 一致性等级、后续标志、下一个对象、对象数量
+	deviceIdHeaderSize = 7
+	// deviceIdMaxPDU PDU 的最大长度
+	deviceIdMaxPDU = 253
+	// deviceIdMaxFrames 流式读取最多读取的帧数，防止从站一直返回“还有后续”
+	deviceIdMaxFrames = 64
+	// moreFollows 响应中“还有后续”的标志
+	moreFollows = 0xFF
+)
+
+// DeviceIdentification 设备标识，从站的厂商、产品代码、版本等信息
+type DeviceIdentification struct {
+	// ConformityLevel 一致性等级，表示支持的访问类型，0x80 位表示支持单个对象访问
+	ConformityLevel byte
+	// Objects 对象编号到对象值，标准对象为 ASCII 字符串
+	Objects map[byte]string
+}
+
+// VendorName 厂商名称
+func (d *DeviceIdentification) VendorName() string {
+	return d.Objects[ObjectIdVendorName]
+}
+
+// ProductCode 产品代码
+func (d *DeviceIdentification) ProductCode() string {
+	return d.Objects[ObjectIdProductCode]
+}
+
+// MajorMinorRevision 版本号
+func (d *DeviceIdentification) MajorMinorRevision() string {
+	return d.Objects[ObjectIdMajorMinorRevision]
+}
+
+// IDs 按编号排序的对象编号
+func (d *DeviceIdentification) IDs() (ids []byte) {
+	for id := range d.Objects {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return
+}
+
+func (d *DeviceIdentification) String() string {
+	parts := make([]string, 0, len(d.Objects))
+	for _, id := range d.IDs() {
+		parts = append(parts, fmt.Sprintf("%s=%q", ObjectName(id), d.Objects[id]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// ObjectName 返回对象名称，非标准对象返回十六进制编号
+func ObjectName(id byte) string {
+	switch id {
+	case ObjectIdVendorName:
+		return "VendorName"
+	case ObjectIdProductCode:
+		return "ProductCode"
+	case ObjectIdMajorMinorRevision:
+		return "MajorMinorRevision"
+	case ObjectIdVendorUrl:
+		return "VendorUrl"
+	case ObjectIdProductName:
+		return "ProductName"
+	case ObjectIdModelName:
+		return "ModelName"
+	case ObjectIdUserApplicationName:
+		return "UserApplicationName"
+	}
+	return fmt.Sprintf("0x%02X", id)
+}
+
+// lastObjectId 返回访问类型可以读取的最后一个对象编号
+func lastObjectId(readDeviceIdCode byte) byte {
+	switch readDeviceIdCode {
+	case ReadDeviceIdBasic:
+		return ObjectIdMajorMinorRevision
+	case ReadDeviceIdRegular:
+		return 0x7F
+	}
+	return 0xFF
+}
+
+func (cli *client) ReadDeviceIdentification(readDeviceIdCode, objectId byte) (results *DeviceIdentification, err error) {
+	if readDeviceIdCode < ReadDeviceIdBasic || readDeviceIdCode > ReadDeviceIdIndividual {
+		err = fmt.Errorf("modbus: 访问类型 '%v' 必须在 '%v' 和 '%v' 之间", readDeviceIdCode, ReadDeviceIdBasic, ReadDeviceIdIndividual)
+		return
+	}
+	results = &DeviceIdentification{Objects: make(map[byte]string)}
+	for frames := 1; ; frames++ {
+		request := ProtocolDataUnit{
+			FunctionCode: FuncCodeEncapsulatedInterface,
+			Data:         []byte{MEITypeReadDeviceIdentification, readDeviceIdCode, objectId},
+		}
+		response, err := cli.send(&request)
+		if err != nil {
+			return nil, err
+		}
+		more, next, err := results.decode(response.Data, readDeviceIdCode)
+		if err != nil {
+			return nil, err
+		}
+		if !more || readDeviceIdCode == ReadDeviceIdIndividual {
+			return results, nil
+		}
+		if next <= objectId || frames >= deviceIdMaxFrames {
+			return nil, fmt.Errorf("modbus: 设备标识的下一个对象 '%v' 不合法", next)
+		}
+		objectId = next
+	}
+}
+
+// decode 解析一帧响应的数据（MEI 类型之后的部分），把对象加入 d，
+// 返回是否还有后续帧及下一帧的起始对象
+func (d *DeviceIdentification) decode(data []byte, readDeviceIdCode byte) (more bool, next byte, err error) {
+	if len(data) < deviceIdHeaderSize-1 {
+		err = fmt.Errorf("modbus: 设备标识响应长度 '%v' 低于最小长度 '%v'", len(data), deviceIdHeaderSize-1)
+		return
+	}
+	if data[0] != MEITypeReadDeviceIdentification {
+		err = fmt.Errorf("modbus: 响应 MEI 类型 '%v' 与请求 '%v' 不匹配", data[0], MEITypeReadDeviceIdentification)
+		return
+	}
+	if data[1] != readDeviceIdCode {
+		err = fmt.Errorf("modbus: 响应访问类型 '%v' 与请求 '%v' 不匹配", data[1], readDeviceIdCode)
+		return
+	}
+	d.ConformityLevel = data[2]
+	more, next = data[3] == moreFollows, data[4]
+	count := int(data[5])
+	offset := deviceIdHeaderSize - 1
+	for i := 0; i < count; i++ {
+		if offset+2 > len(data) || offset+2+int(data[offset+1]) > len(data) {
+			err = fmt.Errorf("modbus: 设备标识响应中第 '%v' 个对象不完整", i+1)
+			return
+		}
+		id, length := data[offset], int(data[offset+1])
+		d.Objects[id] = string(data[offset+2 : offset+2+length])
+		offset += 2 + length
+	}
+	return
+}
+
+// Response 按请求的访问类型和起始对象生成一帧读设备标识响应的数据（功能码之后的部分），
+// 供从站使用。对象太多放不下一帧时设置“还有后续”，主站从下一个对象继续读取。
+// 请求不合法时返回的错误为 *ModbusError，其中的异常码可以直接作为异常响应返回。
+func (d *DeviceIdentification) Response(readDeviceIdCode, objectId byte) (data []byte, err error) {
+	exception := func(code byte) error {
+		return &ModbusError{FunctionCode: FuncCodeEncapsulatedInterface, ExceptionCode: code}
+	}
+	if readDeviceIdCode < ReadDeviceIdBasic || readDeviceIdCode > ReadDeviceIdIndividual {
+		return nil, exception(ExceptionCodeIllegalDataValue)
+	}
+	var ids []byte
+	if readDeviceIdCode == ReadDeviceIdIndividual {
+		if _, ok := d.Objects[objectId]; !ok {
+			return nil, exception(ExceptionCodeIllegalDataAddress)
+		}
+		ids = []byte{objectId}
+	} else {
+		last := lastObjectId(readDeviceIdCode)
+		// 流式读取时起始对象不存在则从头开始
+		if _, ok := d.Objects[objectId]; !ok || objectId > last {
+			objectId = 0
+		}
+		for _, id := range d.IDs() {
+			if id >= objectId && id <= last {
+				ids = append(ids, id)
+			}
+		}
+	}
+	data = []byte{MEITypeReadDeviceIdentification, readDeviceIdCode, d.ConformityLevel, 0, 0, 0}
+	size := deviceIdHeaderSize
+	for i, id := range ids {
+		value := d.Objects[id]
+		if len(value) > deviceIdMaxPDU-deviceIdHeaderSize-2 {
+			return nil, exception(ExceptionCodeServerDeviceFailure)
+		}
+		if size+2+len(value) > deviceIdMaxPDU {
+			data[3], data[4] = moreFollows, id
+			break
+		}
+		data = append(data, id, byte(len(value)))
+		data = append(data, value...)
+		data[5] = byte(i + 1)
+		size += 2 + len(value)
+	}
+	return
+}
+
+// ScanResult 扫描到的一个站
+type ScanResult struct {
+	// Port 串口名或 TCP 服务器地址
+	Port    string
+	SlaveId byte
+	// Identification 设备标识，从站不支持读设备标识时为 nil
+	Identification *DeviceIdentification
+	// ServerId 不支持读设备标识时用功能码 17 读取的从站 ID，也不支持时为 nil
+	ServerId *ServerId
+}
+
+// Scan 按连接参数扫描所有端口上 ScanFrom 到 ScanTo 的站号，用读设备标识识别从站，
+// 每找到一个站调用一次 found。读设备标识没有响应的站号跳过；响应出错时用读输入寄存器
+// 确认是否在线。不支持读设备标识的从站尝试用功能码 17 读取从站 ID。
+func Scan(opts *Options, readDeviceIdCode byte, found func(r *ScanResult)) error {
+	targets, err := scanTargets(opts)
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		client, err := openTarget(opts, target)
+		if err != nil {
+			log.Printf("端口%s被占用\n", target)
+			continue
+		}
+		for id := int(opts.ScanFrom); id <= int(opts.ScanTo); id++ {
+			client.SetSlaveId(byte(id))
+			r := &ScanResult{Port: client.PortName(), SlaveId: byte(id)}
+			r.Identification, err = client.ReadDeviceIdentification(readDeviceIdCode, ObjectIdVendorName)
+			if err != nil {
+				// 没有响应说明站号不存在，不再用普通读取多等一次超时；
+				// 返回了异常响应说明从站在线，只是不支持该功能码；其他错误再试一次普通读取
+				if IsTimeout(err) {
+					continue
+				}
+				var mbErr *ModbusError
+				if !errors.As(err, &mbErr) && client.Try(byte(id)) != nil {
+					continue
+				}
+				r.Identification = nil
+				r.ServerId, _ = client.ReportServerId()
+			}
+			found(r)
+		}
+		_ = client.Close()
+	}
+	return nil
+}
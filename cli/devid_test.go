@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func deviceIdClient(d *DeviceIdentification, chunk int) Client {
+	port := &loopbackPort{chunk: chunk, handler: func(functionCode byte, request []byte) ([]byte, error) {
+		if functionCode != FuncCodeEncapsulatedInterface || len(request) != 3 || request[0] != MEITypeReadDeviceIdentification {
+			return nil, &ModbusError{FunctionCode: functionCode, ExceptionCode: ExceptionCodeIllegalFunction}
+		}
+		return d.Response(request[1], request[2])
+	}}
+	return newClient(&DefaultOptions().Mode, port, 1)
+}
+
+func TestReadDeviceIdentification(t *testing.T) {
+	d := &DeviceIdentification{ConformityLevel: 0x83, Objects: map[byte]string{
+		ObjectIdVendorName:         "go-oak",
+		ObjectIdProductCode:        "TH-01",
+		ObjectIdMajorMinorRevision: "V1.2",
+		ObjectIdProductName:        strings.Repeat("P", 120),
+		ObjectIdModelName:          strings.Repeat("M", 120),
+		0x80:                       "private",
+	}}
+	// 每次读出 3 个字节，按已收到的对象计算响应长度
+	c := deviceIdClient(d, 3)
+
+	res, err := c.ReadDeviceIdentification(ReadDeviceIdBasic, ObjectIdVendorName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.VendorName() != "go-oak" || res.ProductCode() != "TH-01" || res.MajorMinorRevision() != "V1.2" ||
+		len(res.Objects) != 3 || res.ConformityLevel != 0x83 {
+		t.Fatalf("基本对象 %v", res)
+	}
+
+	// 常规对象放不下一帧，分两帧读取
+	res, err = c.ReadDeviceIdentification(ReadDeviceIdRegular, ObjectIdVendorName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Objects) != 5 || res.Objects[ObjectIdModelName] != d.Objects[ObjectIdModelName] {
+		t.Fatalf("常规对象 %v", res.IDs())
+	}
+	data, _ := d.Response(ReadDeviceIdRegular, ObjectIdVendorName)
+	if data[3] != moreFollows || data[4] != ObjectIdModelName {
+		t.Fatalf("第一帧的后续标志 %02X，下一个对象 %02X", data[3], data[4])
+	}
+
+	res, err = c.ReadDeviceIdentification(ReadDeviceIdExtended, ObjectIdVendorName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Objects) != 6 || res.Objects[0x80] != "private" {
+		t.Fatalf("扩展对象 %v", res.IDs())
+	}
+
+	res, err = c.ReadDeviceIdentification(ReadDeviceIdIndividual, 0x80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Objects) != 1 || res.Objects[0x80] != "private" {
+		t.Fatalf("单个对象 %v", res)
+	}
+
+	var mbErr *ModbusError
+	if _, err = c.ReadDeviceIdentification(ReadDeviceIdIndividual, 0x10); !errors.As(err, &mbErr) ||
+		mbErr.ExceptionCode != ExceptionCodeIllegalDataAddress {
+		t.Fatalf("不存在的对象应返回非法地址，得到 %v", err)
+	}
+}
+
+func TestDeviceIdentificationDecode(t *testing.T) {
+	d := &DeviceIdentification{Objects: make(map[byte]string)}
+	if _, _, err := d.decode([]byte{MEITypeReadDeviceIdentification, 1, 0x81, 0, 0}, 1); err == nil {
+		t.Error("太短的响应应该报错")
+	}
+	if _, _, err := d.decode([]byte{MEITypeReadDeviceIdentification, 2, 0x81, 0, 0, 0}, 1); err == nil {
+		t.Error("访问类型不一致应该报错")
+	}
+	if _, _, err := d.decode([]byte{MEITypeReadDeviceIdentification, 1, 0x81, 0, 0, 1, 0, 5, 'a'}, 1); err == nil {
+		t.Error("不完整的对象应该报错")
+	}
+	more, next, err := d.decode([]byte{MEITypeReadDeviceIdentification, 1, 0x81, moreFollows, 2, 2, 0, 1, 'a', 1, 0}, 1)
+	if err != nil || !more || next != 2 || d.Objects[0] != "a" || d.Objects[1] != "" {
+		t.Errorf("decode = %v %v %v，对象 %v", more, next, err, d.Objects)
+	}
+}
+
+func TestDeviceIdResponseLength(t *testing.T) {
+	frame := rtuFrame(1, FuncCodeEncapsulatedInterface, MEITypeReadDeviceIdentification, 1, 0x81, 0, 0, 2, 0, 2, 'a', 'b', 1, 1, 'c')
+	// 按收到的字节逐步计算，收全之前返回的长度不超过实际长度，收全后等于实际长度
+	for n := 0; n <= len(frame); n++ {
+		got := deviceIdResponseLength(frame[:n], 9)
+		if got > len(frame) {
+			t.Fatalf("收到 %d 字节时长度 %d 超过帧长 %d", n, got, len(frame))
+		}
+		if n >= 1+deviceIdHeaderSize+7 && got != len(frame) {
+			t.Fatalf("对象收全后长度 %d，预期 %d", got, len(frame))
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// 诊断（功能码 08）的子功能码
+const (
+	DiagReturnQueryData            = 0x00 // 回环，原样返回请求数据
+	DiagRestartCommunications      = 0x01 // 重启通信，退出只听模式，数据 0xFF00 时同时清空事件日志
+	DiagReturnDiagnosticRegister   = 0x02
+	DiagForceListenOnlyMode        = 0x04 // 只听模式，从站不再响应，直到重启通信
+	DiagClearCounters              = 0x0A // 清零所有计数器和诊断寄存器
+	DiagBusMessageCount            = 0x0B // 总线上收到的报文数
+	DiagBusCommunicationErrorCount = 0x0C // CRC 错误数
+	DiagBusExceptionErrorCount     = 0x0D // 返回的异常响应数
+	DiagServerMessageCount         = 0x0E // 发给本站（含广播）的报文数
+	DiagServerNoResponseCount      = 0x0F // 未响应的报文数
+	DiagServerNAKCount             = 0x10
+	DiagServerBusyCount            = 0x11
+	DiagBusCharacterOverrunCount   = 0x12
+	DiagClearOverrunCounter        = 0x14
+)
+
+// CommEventBusy GetCommEventCounter 和 GetCommEventLog 返回的状态，表示从站仍在处理上一条命令
+const CommEventBusy = 0xFFFF
+
+// DiagnosticName 返回诊断子功能码的名称
+func DiagnosticName(subFunction uint16) string {
+	switch subFunction {
+	case DiagReturnQueryData:
+		return "return query data"
+	case DiagRestartCommunications:
+		return "restart communications"
+	case DiagReturnDiagnosticRegister:
+		return "return diagnostic register"
+	case DiagForceListenOnlyMode:
+		return "force listen only mode"
+	case DiagClearCounters:
+		return "clear counters"
+	case DiagBusMessageCount:
+		return "bus message count"
+	case DiagBusCommunicationErrorCount:
+		return "bus communication error count"
+	case DiagBusExceptionErrorCount:
+		return "bus exception error count"
+	case DiagServerMessageCount:
+		return "server message count"
+	case DiagServerNoResponseCount:
+		return "server no response count"
+	case DiagServerNAKCount:
+		return "server NAK count"
+	case DiagServerBusyCount:
+		return "server busy count"
+	case DiagBusCharacterOverrunCount:
+		return "bus character overrun count"
+	case DiagClearOverrunCounter:
+		return "clear overrun counter"
+	}
+	return fmt.Sprintf("0x%02X", subFunction)
+}
+
+func (cli *client) Diagnostics(subFunction uint16, data []byte) (results []byte, err error) {
+	request := ProtocolDataUnit{
+		FunctionCode: FuncCodeDiagnostics,
+		Data:         append(dataBlock(subFunction), data...),
+	}
+	response, err := cli.send(&request)
+	if err != nil {
+		// 进入只听模式的从站不响应。重启通信的超时仍然返回，
+		// 由调用方区分从站处于只听模式还是离线
+		if subFunction == DiagForceListenOnlyMode && IsTimeout(err) {
+			err = nil
+		}
+		return
+	}
+	if len(response.Data) < 2 {
+		err = fmt.Errorf("modbus: 响应长度 '%v' 低于最小长度 '%v'", len(response.Data), 2)
+		return
+	}
+	if respValue := binary.BigEndian.Uint16(response.Data); respValue != subFunction {
+		err = fmt.Errorf("modbus: 响应子功能码 '%v' 与请求子功能码 '%v' 不匹配", respValue, subFunction)
+		return
+	}
+	results = response.Data[2:]
+	if subFunction == DiagReturnQueryData && !bytes.Equal(results, data) {
+		err = fmt.Errorf("modbus: 回环数据 '% X' 与发送的数据 '% X' 不一致", results, data)
+		return
+	}
+	return
+}
+
+// DiagnosticCounter 读取一个诊断计数器，subFunction 为 DiagBusMessageCount 等
+func DiagnosticCounter(c Client, subFunction uint16) (count uint16, err error) {
+	results, err := c.Diagnostics(subFunction, dataBlock(0))
+	if err != nil {
+		return
+	}
+	if len(results) != 2 {
+		err = fmt.Errorf("modbus: 响应长度 '%v' 与预期接收长度 '%v' 不匹配", len(results), 2)
+		return
+	}
+	return binary.BigEndian.Uint16(results), nil
+}
+
+func (cli *client) GetCommEventCounter() (status, eventCount uint16, err error) {
+	request := ProtocolDataUnit{FunctionCode: FuncCodeGetCommEventCounter}
+	response, err := cli.send(&request)
+	if err != nil {
+		return
+	}
+	if len(response.Data) != 4 {
+		err = fmt.Errorf("modbus: 响应长度 '%v' 与预期接收长度 '%v' 不匹配", len(response.Data), 4)
+		return
+	}
+	status = binary.BigEndian.Uint16(response.Data)
+	eventCount = binary.BigEndian.Uint16(response.Data[2:])
+	return
+}
+
+// CommEventLog 通信事件日志
+type CommEventLog struct {
+	// Status 为 CommEventBusy 表示从站正忙
+	Status       uint16
+	EventCount   uint16
+	MessageCount uint16
+	// Events 事件，最近的在前
+	Events []CommEvent
+}
+
+func (cli *client) GetCommEventLog() (results *CommEventLog, err error) {
+	request := ProtocolDataUnit{FunctionCode: FuncCodeGetCommEventLog}
+	response, err := cli.send(&request)
+	if err != nil {
+		return
+	}
+	count := int(response.Data[0])
+	length := len(response.Data) - 1
+	if count != length {
+		err = fmt.Errorf("modbus: 响应长度 '%v' 不匹配实际接收长度 '%v'", length, count)
+		return
+	}
+	if count < 6 {
+		err = fmt.Errorf("modbus: 事件日志长度 '%v' 低于最小长度 '%v'", count, 6)
+		return
+	}
+	data := response.Data[1:]
+	results = &CommEventLog{
+		Status:       binary.BigEndian.Uint16(data),
+		EventCount:   binary.BigEndian.Uint16(data[2:]),
+		MessageCount: binary.BigEndian.Uint16(data[4:]),
+	}
+	for _, e := range data[6:] {
+		results.Events = append(results.Events, CommEvent(e))
+	}
+	return
+}
+
+// CommEvent 通信事件日志中的一个事件
+type CommEvent byte
+
+// 通信事件
+const (
+	CommEventRestart        CommEvent = 0x00 // 重启通信
+	CommEventListenOnly     CommEvent = 0x04 // 进入只听模式
+	CommEventReceive        CommEvent = 0x80 // 收到报文，低位见 CommEventReceive*
+	CommEventSend           CommEvent = 0x40 // 发出响应，低位见 CommEventSend*
+	CommEventReceiveError   CommEvent = 0x02 // 通信错误（CRC 等）
+	CommEventReceiveOverrun CommEvent = 0x10 // 字符溢出
+	CommEventReceiveListen  CommEvent = 0x20 // 处于只听模式
+	CommEventReceiveBcast   CommEvent = 0x40 // 收到广播
+	CommEventSendException  CommEvent = 0x01 // 读异常（异常码 1-3）
+	CommEventSendAbort      CommEvent = 0x02 // 从站故障异常（异常码 4）
+	CommEventSendBusy       CommEvent = 0x04 // 忙异常（异常码 5-6）
+	CommEventSendNAK        CommEvent = 0x08 // NAK 异常（异常码 7）
+	CommEventSendTimeout    CommEvent = 0x10 // 写超时
+	CommEventSendListen     CommEvent = 0x20 // 处于只听模式
+)
+
+func (e CommEvent) String() string {
+	var (
+		kind  string
+		flags []string
+	)
+	add := func(bit CommEvent, name string) {
+		if e&bit != 0 {
+			flags = append(flags, name)
+		}
+	}
+	switch {
+	case e == CommEventRestart:
+		return "restart"
+	case e == CommEventListenOnly:
+		return "listen-only"
+	case e&CommEventReceive != 0:
+		kind = "rx"
+		add(CommEventReceiveError, "comm-error")
+		add(CommEventReceiveOverrun, "overrun")
+		add(CommEventReceiveListen, "listen-only")
+		add(CommEventReceiveBcast, "broadcast")
+	case e&CommEventSend != 0:
+		kind = "tx"
+		add(CommEventSendException, "exception")
+		add(CommEventSendAbort, "abort")
+		add(CommEventSendBusy, "busy")
+		add(CommEventSendNAK, "nak")
+		add(CommEventSendTimeout, "write-timeout")
+		add(CommEventSendListen, "listen-only")
+	default:
+		return fmt.Sprintf("0x%02X", byte(e))
+	}
+	if len(flags) == 0 {
+		return kind
+	}
+	return kind + "(" + strings.Join(flags, ",") + ")"
+}
@@ -0,0 +1,17 @@
+package cli
+
+import "testing"
+
+func TestDiagnosticsNoResponse(t *testing.T) {
+	// 异常码 11 与从站没有响应的处理相同
+	port := &loopbackPort{handler: func(functionCode byte, request []byte) ([]byte, error) {
+		return nil, &ModbusError{FunctionCode: functionCode, ExceptionCode: ExceptionCodeGatewayTargetDeviceFailedToRespond}
+	}}
+	c := newClient(&DefaultOptions().Mode, port, 1)
+	if _, err := c.Diagnostics(DiagForceListenOnlyMode, []byte{0, 0}); err != nil {
+		t.Fatalf("进入只听模式时从站不响应，不应该报错: %v", err)
+	}
+	if _, err := c.Diagnostics(DiagRestartCommunications, []byte{0, 0}); !IsTimeout(err) {
+		t.Fatalf("重启通信没有响应时应该返回超时，得到 %v", err)
+	}
+}
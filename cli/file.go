@@ -0,0 +1,290 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// fileRecordReferenceType 文件记录子请求的引用类型，固定为 6
+	fileRecordReferenceType = 6
+	// fileRecordMaxBytes 文件记录请求和响应中字节数的最大值
+	fileRecordMaxBytes = 0xF5
+	// fileRecordMaxNumber 记录号的最大值
+	fileRecordMaxNumber = 0x270F
+	// fifoMaxCount FIFO 队列中寄存器数量的最大值
+	fifoMaxCount = 31
+)
+
+// FileRecord 文件记录访问的一个子请求：从文件 File 的第 Record 个记录开始的 Length 个寄存器
+type FileRecord struct {
+	File   uint16
+	Record uint16
+	// Length 读取的寄存器数，写入时按 Data 的长度计算
+	Length uint16
+	// Data 记录数据，每个寄存器两个字节，高字节在前
+	Data []byte
+}
+
+func (r *FileRecord) validate() error {
+	if r.File == 0 {
+		return fmt.Errorf("modbus: 文件号不能为 0")
+	}
+	if r.Record > fileRecordMaxNumber {
+		return fmt.Errorf("modbus: 记录号 '%v' 必须在 '%v' 和 '%v' 之间", r.Record, 0, fileRecordMaxNumber)
+	}
+	return nil
+}
+
+func (cli *client) ReadFileRecords(records []FileRecord) (results []FileRecord, err error) {
+	if len(records) == 0 {
+		err = fmt.Errorf("modbus: 没有文件记录子请求")
+		return
+	}
+	data := []byte{0}
+	size := 0 // 响应的字节数
+	for i := range records {
+		r := &records[i]
+		if err = r.validate(); err != nil {
+			return
+		}
+		if r.Length == 0 {
+			err = fmt.Errorf("modbus: 文件 '%v' 记录 '%v' 的读取长度不能为 0", r.File, r.Record)
+			return
+		}
+		data = append(data, fileRecordReferenceType)
+		data = append(data, dataBlock(r.File, r.Record, r.Length)...)
+		size += 2 + int(r.Length)*2
+	}
+	if len(data)-1 > fileRecordMaxBytes || size > fileRecordMaxBytes {
+		err = fmt.Errorf("modbus: 文件记录请求或响应的长度不能大于 '%v'", fileRecordMaxBytes)
+		return
+	}
+	data[0] = byte(len(data) - 1)
+	request := ProtocolDataUnit{
+		FunctionCode: FuncCodeReadFileRecord,
+		Data:         data,
+	}
+	response, err := cli.send(&request)
+	if err != nil {
+		return
+	}
+	count := int(response.Data[0])
+	length := len(response.Data) - 1
+	if count != length {
+		err = fmt.Errorf("modbus: 响应长度 '%v' 不匹配实际接收长度 '%v'", length, count)
+		return
+	}
+	rest := response.Data[1:]
+	results = make([]FileRecord, len(records))
+	for i, r := range records {
+		// 子响应：长度（含引用类型）、引用类型、记录数据
+		if len(rest) < 2 || int(rest[0]) < 1 || len(rest) < 1+int(rest[0]) {
+			return nil, fmt.Errorf("modbus: 第 '%v' 个文件记录子响应不完整", i+1)
+		}
+		if rest[1] != fileRecordReferenceType {
+			return nil, fmt.Errorf("modbus: 子响应引用类型 '%v' 与预期 '%v' 不匹配", rest[1], fileRecordReferenceType)
+		}
+		if n := int(rest[0]) - 1; n != int(r.Length)*2 {
+			return nil, fmt.Errorf("modbus: 文件 '%v' 记录 '%v' 的数据长度 '%v' 与请求长度 '%v' 不匹配", r.File, r.Record, n, int(r.Length)*2)
+		}
+		r.Data = rest[2 : 1+int(rest[0])]
+		results[i] = r
+		rest = rest[1+int(rest[0]):]
+	}
+	return
+}
+
+func (cli *client) WriteFileRecords(records []FileRecord) (err error) {
+	if len(records) == 0 {
+		return fmt.Errorf("modbus: 没有文件记录子请求")
+	}
+	data := []byte{0}
+	for i := range records {
+		r := &records[i]
+		if err = r.validate(); err != nil {
+			return
+		}
+		if len(r.Data) == 0 || len(r.Data)%2 != 0 {
+			return fmt.Errorf("modbus: 文件 '%v' 记录 '%v' 的数据长度 '%v' 必须是不为 0 的偶数", r.File, r.Record, len(r.Data))
+		}
+		data = append(data, fileRecordReferenceType)
+		data = append(data, dataBlock(r.File, r.Record, uint16(len(r.Data)/2))...)
+		data = append(data, r.Data...)
+	}
+	if len(data)-1 > fileRecordMaxBytes {
+		return fmt.Errorf("modbus: 文件记录请求的长度不能大于 '%v'", fileRecordMaxBytes)
+	}
+	data[0] = byte(len(data) - 1)
+	request := ProtocolDataUnit{
+		FunctionCode: FuncCodeWriteFileRecord,
+		Data:         data,
+	}
+	response, err := cli.send(&request)
+	if err != nil {
+		return
+	}
+	// 响应与请求相同
+	if !bytes.Equal(response.Data, data) {
+		return fmt.Errorf("modbus: 写文件记录的响应 '% X' 与请求不一致", response.Data)
+	}
+	return
+}
+
+func (cli *client) ReadFIFOQueue(address uint16) (results []byte, err error) {
+	request := ProtocolDataUnit{
+		FunctionCode: FuncCodeReadFIFOQueue,
+		Data:         dataBlock(address),
+	}
+	response, err := cli.send(&request)
+	if err != nil {
+		return
+	}
+	// 两个字节的字节数，之后是两个字节的 FIFO 计数和寄存器值
+	if len(response.Data) < 4 {
+		err = fmt.Errorf("modbus: 响应长度 '%v' 低于最小长度 '%v'", len(response.Data), 4)
+		return
+	}
+	count := int(binary.BigEndian.Uint16(response.Data))
+	length := len(response.Data) - 2
+	if count != length {
+		err = fmt.Errorf("modbus: 响应长度 '%v' 不匹配实际接收长度 '%v'", length, count)
+		return
+	}
+	fifoCount := int(binary.BigEndian.Uint16(response.Data[2:]))
+	if fifoCount > fifoMaxCount {
+		err = fmt.Errorf("modbus: FIFO 计数 '%v' 不能大于 '%v'", fifoCount, fifoMaxCount)
+		return
+	}
+	if fifoCount*2 != length-2 {
+		err = fmt.Errorf("modbus: FIFO 计数 '%v' 与数据长度 '%v' 不匹配", fifoCount, length-2)
+		return
+	}
+	results = response.Data[4:]
+	return
+}
+
+// FileStore 从站的文件记录和 FIFO 队列，按功能码 20、21、24 的请求生成响应数据，供从站使用。
+// 请求不合法时返回的错误为 *ModbusError，其中的异常码可以直接作为异常响应返回。
+// FileStore 不加锁，并发访问时由调用方保证互斥。
+type FileStore struct {
+	// Files 文件号到文件内容，第 n 个元素为记录号 n 的寄存器
+	Files map[uint16][]uint16
+	// FIFOs FIFO 指针地址到队列中的寄存器，第一个元素最先读出
+	FIFOs map[uint16][]uint16
+}
+
+// NewFileStore 创建空的 FileStore
+func NewFileStore() *FileStore {
+	return &FileStore{Files: make(map[uint16][]uint16), FIFOs: make(map[uint16][]uint16)}
+}
+
+// fileException 返回功能码 functionCode 的异常
+func fileException(functionCode, code byte) error {
+	return &ModbusError{FunctionCode: functionCode, ExceptionCode: code}
+}
+
+// parseFileRecords 解析读写文件记录请求中的子请求，withData 为 true 时子请求带有记录数据
+func parseFileRecords(functionCode byte, request []byte, withData bool) (records []FileRecord, err error) {
+	if len(request) < 1 || int(request[0]) != len(request)-1 {
+		return nil, fileException(functionCode, ExceptionCodeIllegalDataValue)
+	}
+	rest := request[1:]
+	for len(rest) > 0 {
+		if len(rest) < 7 || rest[0] != fileRecordReferenceType {
+			return nil, fileException(functionCode, ExceptionCodeIllegalDataValue)
+		}
+		r := FileRecord{
+			File:   binary.BigEndian.Uint16(rest[1:]),
+			Record: binary.BigEndian.Uint16(rest[3:]),
+			Length: binary.BigEndian.Uint16(rest[5:]),
+		}
+		rest = rest[7:]
+		if withData {
+			n := int(r.Length) * 2
+			if len(rest) < n {
+				return nil, fileException(functionCode, ExceptionCodeIllegalDataValue)
+			}
+			r.Data, rest = rest[:n], rest[n:]
+		}
+		if r.File == 0 || r.Record > fileRecordMaxNumber || r.Length == 0 {
+			return nil, fileException(functionCode, ExceptionCodeIllegalDataAddress)
+		}
+		records = append(records, r)
+	}
+	if len(records) == 0 {
+		return nil, fileException(functionCode, ExceptionCodeIllegalDataValue)
+	}
+	return
+}
+
+// file 返回记录所在的文件，文件不存在或记录超出文件长度时返回异常
+func (s *FileStore) file(functionCode byte, r *FileRecord) ([]uint16, error) {
+	f, ok := s.Files[r.File]
+	if !ok || int(r.Record)+int(r.Length) > len(f) {
+		return nil, fileException(functionCode, ExceptionCodeIllegalDataAddress)
+	}
+	return f, nil
+}
+
+// ReadFileRecordResponse 按读文件记录请求（功能码 20 之后的部分）生成响应数据
+func (s *FileStore) ReadFileRecordResponse(request []byte) (data []byte, err error) {
+	records, err := parseFileRecords(FuncCodeReadFileRecord, request, false)
+	if err != nil {
+		return
+	}
+	data = []byte{0}
+	for i := range records {
+		r := &records[i]
+		f, e := s.file(FuncCodeReadFileRecord, r)
+		if e != nil {
+			return nil, e
+		}
+		data = append(data, byte(1+int(r.Length)*2), fileRecordReferenceType)
+		data = append(data, dataBlock(f[r.Record:int(r.Record)+int(r.Length)]...)...)
+		if len(data)-1 > fileRecordMaxBytes {
+			return nil, fileException(FuncCodeReadFileRecord, ExceptionCodeIllegalDataValue)
+		}
+	}
+	data[0] = byte(len(data) - 1)
+	return
+}
+
+// WriteFileRecordResponse 执行写文件记录请求（功能码 21 之后的部分）并生成响应数据。
+// 所有子请求都合法时才写入，响应与请求相同
+func (s *FileStore) WriteFileRecordResponse(request []byte) (data []byte, err error) {
+	records, err := parseFileRecords(FuncCodeWriteFileRecord, request, true)
+	if err != nil {
+		return
+	}
+	for i := range records {
+		if _, err = s.file(FuncCodeWriteFileRecord, &records[i]); err != nil {
+			return
+		}
+	}
+	for _, r := range records {
+		f := s.Files[r.File]
+		for i := 0; i < int(r.Length); i++ {
+			f[int(r.Record)+i] = binary.BigEndian.Uint16(r.Data[i*2:])
+		}
+	}
+	return append([]byte(nil), request...), nil
+}
+
+// ReadFIFOQueueResponse 按读 FIFO 队列请求（功能码 24 之后的部分）生成响应数据，
+// 读取后队列内容不变
+func (s *FileStore) ReadFIFOQueueResponse(request []byte) (data []byte, err error) {
+	if len(request) != 2 {
+		return nil, fileException(FuncCodeReadFIFOQueue, ExceptionCodeIllegalDataValue)
+	}
+	queue, ok := s.FIFOs[binary.BigEndian.Uint16(request)]
+	if !ok {
+		return nil, fileException(FuncCodeReadFIFOQueue, ExceptionCodeIllegalDataAddress)
+	}
+	if len(queue) > fifoMaxCount {
+		return nil, fileException(FuncCodeReadFIFOQueue, ExceptionCodeIllegalDataValue)
+	}
+	data = dataBlock(uint16(2+len(queue)*2), uint16(len(queue)))
+	return append(data, dataBlock(queue...)...), nil
+}
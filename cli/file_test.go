@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+// loopbackPort 把 RTU 请求交给 handler 处理，handler 的结果作为响应帧读出，
+// 返回 *ModbusError 时读出异常响应。chunk 大于 0 时每次最多读出 chunk 个字节
+type loopbackPort struct {
+	handler  func(functionCode byte, request []byte) ([]byte, error)
+	response []byte
+	chunk    int
+}
+
+func (p *loopbackPort) Write(b []byte) (int, error) {
+	pdu, err := Decode(b)
+	if err != nil {
+		return 0, err
+	}
+	data, err := p.handler(pdu.FunctionCode, pdu.Data)
+	var mbErr *ModbusError
+	switch {
+	case errors.As(err, &mbErr):
+		p.response = rtuFrame(b[0], pdu.FunctionCode|0x80, mbErr.ExceptionCode)
+	case err != nil:
+		return 0, err
+	default:
+		p.response = rtuFrame(b[0], append([]byte{pdu.FunctionCode}, data...)...)
+	}
+	return len(b), nil
+}
+
+func (p *loopbackPort) Read(b []byte) (int, error) {
+	if p.chunk > 0 && len(b) > p.chunk {
+		b = b[:p.chunk]
+	}
+	n := copy(b, p.response)
+	p.response = p.response[n:]
+	return n, nil
+}
+
+func (p *loopbackPort) SetReadTimeout(t time.Duration) error { return nil }
+func (p *loopbackPort) Close() error                         { return nil }
+
+func fileStoreClient(s *FileStore) Client {
+	port := &loopbackPort{handler: func(functionCode byte, request []byte) ([]byte, error) {
+		switch functionCode {
+		case FuncCodeReadFileRecord:
+			return s.ReadFileRecordResponse(request)
+		case FuncCodeWriteFileRecord:
+			return s.WriteFileRecordResponse(request)
+		case FuncCodeReadFIFOQueue:
+			return s.ReadFIFOQueueResponse(request)
+		}
+		return nil, &ModbusError{FunctionCode: functionCode, ExceptionCode: ExceptionCodeIllegalFunction}
+	}}
+	return newClient(&DefaultOptions().Mode, port, 1)
+}
+
+func TestFileStore(t *testing.T) {
+	s := NewFileStore()
+	s.Files[4] = make([]uint16, 20)
+	s.Files[5] = []uint16{0x0102, 0x0304}
+	s.FIFOs[0x04DE] = []uint16{0x01B8, 0x1284}
+	c := fileStoreClient(s)
+
+	err := c.WriteFileRecords([]FileRecord{{File: 4, Record: 7, Data: []byte{0x06, 0xAF, 0x04, 0xBE}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Files[4][7] != 0x06AF || s.Files[4][8] != 0x04BE {
+		t.Fatalf("写入后的记录 %04X", s.Files[4][6:10])
+	}
+
+	res, err := c.ReadFileRecords([]FileRecord{{File: 4, Record: 7, Length: 2}, {File: 5, Record: 1, Length: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res[0].Data, []byte{0x06, 0xAF, 0x04, 0xBE}) || !bytes.Equal(res[1].Data, []byte{0x03, 0x04}) {
+		t.Fatalf("读取的记录 % X / % X", res[0].Data, res[1].Data)
+	}
+
+	// 超出文件长度的子请求返回异常，整个请求不写入
+	err = c.WriteFileRecords([]FileRecord{{File: 5, Record: 0, Data: []byte{0, 0}}, {File: 5, Record: 2, Data: []byte{0, 0}}})
+	var mbErr *ModbusError
+	if !errors.As(err, &mbErr) || mbErr.ExceptionCode != ExceptionCodeIllegalDataAddress {
+		t.Fatalf("超出文件长度应该返回异常码 2，得到 %v", err)
+	}
+	if s.Files[5][0] != 0x0102 {
+		t.Fatal("请求不合法时不应该写入任何记录")
+	}
+
+	fifo, err := c.ReadFIFOQueue(0x04DE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(fifo, []byte{0x01, 0xB8, 0x12, 0x84}) {
+		t.Fatalf("FIFO 队列 % X", fifo)
+	}
+	if _, err = c.ReadFIFOQueue(1); !errors.As(err, &mbErr) || mbErr.ExceptionCode != ExceptionCodeIllegalDataAddress {
+		t.Fatalf("不存在的 FIFO 应该返回异常码 2，得到 %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"fmt"
+)
+
+// Function 自定义或厂商私有的功能码。注册到 Client 后用 Call 发送，
+// RTU 下按 ResponseLength 接收响应，不需要修改内置功能码的处理；
+// 从站注册到 FunctionHandlers 后由 Handler 生成响应。
+type Function struct {
+	// Code 功能码，Modbus 规定 65-72、100-110 为用户自定义功能码，不能与内置功能码重复
+	Code byte
+	// Encode 把 Call 传入的数据编码成请求数据（功能码之后的部分），nil 时原样发送
+	Encode func(data []byte) (request []byte, err error)
+	// ResponseLength 根据请求数据和已收到的响应数据（都不含功能码）返回响应数据的长度。
+	// partial 还不足以确定长度时返回至少需要的长度，收到更多数据后会再次调用
+	ResponseLength func(request, partial []byte) int
+	// Decode 校验并解析响应数据，返回 Call 的结果，nil 时返回响应数据
+	Decode func(request, response []byte) (results []byte, err error)
+	// Handler 从站处理请求数据（功能码之后的部分）并返回响应数据，
+	// 返回 *ModbusError 时从站回复异常响应
+	Handler func(request []byte) (response []byte, err error)
+}
+
+// checkCode 检查自定义功能码是否可用
+func (f *Function) checkCode() error {
+	if f.Code == 0 || f.Code >= 0x80 {
+		return fmt.Errorf("modbus: 功能码 '%v' 必须在 '%v' 和 '%v' 之间", f.Code, 1, 0x7F)
+	}
+	if FunctionName(f.Code) != "" {
+		return fmt.Errorf("modbus: 功能码 '%v' 是内置功能码", f.Code)
+	}
+	return nil
+}
+
+// FixedLength 返回固定长度的 ResponseLength
+func FixedLength(n int) func(request, partial []byte) int {
+	return func(request, partial []byte) int {
+		return n
+	}
+}
+
+// ByteCountLength 响应数据的第一个字节为之后的字节数时使用的 ResponseLength，
+// 与读寄存器的响应格式相同
+func ByteCountLength(request, partial []byte) int {
+	if len(partial) < 1 {
+		return 1
+	}
+	return 1 + int(partial[0])
+}
+
+// RegisterFunction 注册自定义功能码，同一功能码再次注册时替换
+func (cli *client) RegisterFunction(f *Function) error {
+	if err := f.checkCode(); err != nil {
+		return err
+	}
+	if f.ResponseLength == nil {
+		return fmt.Errorf("modbus: 功能码 '%v' 没有 ResponseLength", f.Code)
+	}
+	if cli.functions == nil {
+		cli.functions = make(map[byte]*Function)
+	}
+	cli.functions[f.Code] = f
+	return nil
+}
+
+func (cli *client) Call(functionCode byte, data []byte) (results []byte, err error) {
+	f := cli.functions[functionCode]
+	if f == nil {
+		err = fmt.Errorf("modbus: 功能码 '%v' 没有注册", functionCode)
+		return
+	}
+	if f.Encode != nil {
+		if data, err = f.Encode(data); err != nil {
+			return
+		}
+	}
+	request := ProtocolDataUnit{
+		FunctionCode: functionCode,
+		Data:         data,
+	}
+	response, err := cli.send(&request)
+	if err != nil {
+		return
+	}
+	if f.Decode == nil {
+		return response.Data, nil
+	}
+	return f.Decode(data, response.Data)
+}
+
+// FunctionHandlers 从站注册的自定义功能码，按功能码把请求交给 Function.Handler
+type FunctionHandlers map[byte]*Function
+
+// Register 注册从站的自定义功能码，同一功能码再次注册时替换
+func (h FunctionHandlers) Register(f *Function) error {
+	if err := f.checkCode(); err != nil {
+		return err
+	}
+	if f.Handler == nil {
+		return fmt.Errorf("modbus: 功能码 '%v' 没有 Handler", f.Code)
+	}
+	h[f.Code] = f
+	return nil
+}
+
+// Handle 处理功能码为 functionCode 的请求数据并返回响应数据，
+// 功能码没有注册时返回非法功能的 *ModbusError
+func (h FunctionHandlers) Handle(functionCode byte, request []byte) (response []byte, err error) {
+	f := h[functionCode]
+	if f == nil {
+		err = &ModbusError{FunctionCode: functionCode, ExceptionCode: ExceptionCodeIllegalFunction}
+		return
+	}
+	return f.Handler(request)
+}
+
+// expectedLength 返回预期的 RTU 响应帧长度，partial 为已收到的部分。
+// 自定义功能码按 Function.ResponseLength 计算，其他按 responseLength 计算
+func (cli *client) expectedLength(aduRequest, partial []byte, expected int) int {
+	f := cli.functions[aduRequest[1]]
+	if f == nil || (len(partial) >= 2 && partial[1] != aduRequest[1]) {
+		return responseLength(aduRequest, partial, expected)
+	}
+	var data []byte
+	if len(partial) > 2 {
+		data = partial[2:]
+	}
+	return rtuMinSize + f.ResponseLength(aduRequest[2:len(aduRequest)-2], data)
+}
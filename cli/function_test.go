@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestFunctionHandlers(t *testing.T) {
+	// 厂商功能码 101：请求为要读取的字节数，响应为字节数和相应个数的数据
+	f := &Function{
+		Code:           101,
+		ResponseLength: ByteCountLength,
+		Decode: func(request, response []byte) ([]byte, error) {
+			return response[1:], nil
+		},
+		Handler: func(request []byte) ([]byte, error) {
+			if len(request) != 1 || request[0] > 8 {
+				return nil, &ModbusError{FunctionCode: 101, ExceptionCode: ExceptionCodeIllegalDataValue}
+			}
+			return append([]byte{request[0]}, []byte("ABCDEFGH")[:request[0]]...), nil
+		},
+	}
+	handlers := make(FunctionHandlers)
+	if err := handlers.Register(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := handlers.Register(&Function{Code: FuncCodeReadCoils, Handler: f.Handler}); err == nil {
+		t.Fatal("内置功能码不能注册")
+	}
+	if err := handlers.Register(&Function{Code: 102}); err == nil {
+		t.Fatal("没有 Handler 的功能码不能注册")
+	}
+
+	c := newClient(&DefaultOptions().Mode, &loopbackPort{handler: handlers.Handle}, 1)
+	for _, fn := range []*Function{f, {Code: 102, ResponseLength: FixedLength(0)}} {
+		if err := c.RegisterFunction(fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := c.Call(101, []byte{3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res, []byte("ABC")) {
+		t.Fatalf("Call 返回 %q，预期 ABC", res)
+	}
+
+	var mbErr *ModbusError
+	if _, err = c.Call(101, []byte{9}); !errors.As(err, &mbErr) || mbErr.ExceptionCode != ExceptionCodeIllegalDataValue {
+		t.Fatalf("非法数据应返回异常响应，得到 %v", err)
+	}
+	if _, err = c.Call(102, nil); !errors.As(err, &mbErr) || mbErr.ExceptionCode != ExceptionCodeIllegalFunction {
+		t.Fatalf("从站没有注册的功能码应返回非法功能，得到 %v", err)
+	}
+}
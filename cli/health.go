@@ -0,0 +1,193 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"go-oak/util"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen 站点连续失败次数过多，熔断期间不再发送请求
+var ErrCircuitOpen = errors.New("modbus: 站点已熔断")
+
+// CircuitState 站点熔断器状态
+type CircuitState int
+
+const (
+	CircuitClosed   CircuitState = iota // 正常通信
+	CircuitOpen                         // 熔断，暂停请求
+	CircuitHalfOpen                     // 退避时间已到，允许一次探测
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "online"
+	case CircuitOpen:
+		return "offline"
+	case CircuitHalfOpen:
+		return "probing"
+	default:
+		return "unknown"
+	}
+}
+
+// HealthPolicy 熔断策略
+type HealthPolicy struct {
+	// FailureThreshold 连续失败多少次后熔断，<= 0 表示不熔断
+	FailureThreshold int
+	// BaseBackoff 第一次熔断后等待多久再探测
+	BaseBackoff time.Duration
+	// MaxBackoff 探测失败时退避时间翻倍，最长不超过 MaxBackoff
+	MaxBackoff time.Duration
+}
+
+// DefaultHealthPolicy 默认熔断策略
+var DefaultHealthPolicy = HealthPolicy{
+	FailureThreshold: 3,
+	BaseBackoff:      2 * time.Second,
+	MaxBackoff:       time.Minute,
+}
+
+// StationHealth 单个站点的通信统计
+type StationHealth struct {
+	SlaveId             byte
+	State               CircuitState
+	Successes           uint64
+	Failures            uint64
+	ConsecutiveFailures int
+	LastSuccess         time.Time
+	LastFailure         time.Time
+	LastError           error
+	// RetryAt 熔断状态下下一次允许探测的时间
+	RetryAt time.Time
+}
+
+// station 站点健康状态及当前退避时间
+type station struct {
+	StationHealth
+	backoff time.Duration
+	// probing 半开状态下已有一个探测请求在进行，其他请求继续拒绝
+	probing bool
+}
+
+// healthTracker 按站号记录通信成功/失败，实现熔断和指数退避探测
+type healthTracker struct {
+	mu       sync.Mutex
+	policy   HealthPolicy
+	stations map[byte]*station
+	now      func() time.Time
+}
+
+func newHealthTracker(policy HealthPolicy) *healthTracker {
+	return &healthTracker{policy: policy, stations: make(map[byte]*station), now: time.Now}
+}
+
+func (h *healthTracker) station(id byte) *station {
+	s, ok := h.stations[id]
+	if !ok {
+		s = &station{StationHealth: StationHealth{SlaveId: id}}
+		h.stations[id] = s
+	}
+	return s
+}
+
+// allow 判断是否可以向站点发送请求。退避时间到后只放行一个探测请求，
+// 探测结果由 record 记录之前，其他请求仍然被拒绝
+func (h *healthTracker) allow(id byte) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.station(id)
+	switch s.State {
+	case CircuitClosed:
+		return nil
+	case CircuitHalfOpen:
+		if s.probing {
+			return fmt.Errorf("%w: 站号 %d，正在探测", ErrCircuitOpen, id)
+		}
+	case CircuitOpen:
+		if now := h.now(); now.Before(s.RetryAt) {
+			return fmt.Errorf("%w: 站号 %d，%v 后重试", ErrCircuitOpen, id, s.RetryAt.Sub(now).Round(time.Millisecond))
+		}
+		s.State = CircuitHalfOpen
+	}
+	s.probing = true
+	return nil
+}
+
+// record 记录一次请求结果。收到异常响应说明站点在线，计为成功；
+// 端口掉线不是站点的问题，不计入统计。
+func (h *healthTracker) record(id byte, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.station(id)
+	s.probing = false
+	if errors.Is(err, util.ErrPortLost) {
+		return
+	}
+	now := h.now()
+	if err == nil || !isCommError(err) {
+		s.Successes++
+		s.LastSuccess = now
+		s.ConsecutiveFailures = 0
+		s.State = CircuitClosed
+		s.backoff = 0
+		return
+	}
+	s.Failures++
+	s.LastFailure = now
+	s.LastError = err
+	s.ConsecutiveFailures++
+	switch {
+	case s.State == CircuitHalfOpen:
+		s.backoff *= 2
+		if s.backoff > h.policy.MaxBackoff {
+			s.backoff = h.policy.MaxBackoff
+		}
+	case h.policy.FailureThreshold > 0 && s.ConsecutiveFailures >= h.policy.FailureThreshold:
+		s.backoff = h.policy.BaseBackoff
+	default:
+		return
+	}
+	s.State = CircuitOpen
+	s.RetryAt = now.Add(s.backoff)
+}
+
+// snapshot 返回按站号排序的所有站点状态
+func (h *healthTracker) snapshot() []StationHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	res := make([]StationHealth, 0, len(h.stations))
+	for _, s := range h.stations {
+		res = append(res, s.StationHealth)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].SlaveId < res[j].SlaveId })
+	return res
+}
+
+// isCommError 判断是否为通信失败（超时、无响应、校验错误等），
+// 站点返回的异常码不算通信失败。
+func isCommError(err error) bool {
+	var mbErr *ModbusError
+	if errors.As(err, &mbErr) {
+		return mbErr.ExceptionCode == ExceptionCodeGatewayTargetDeviceFailedToRespond
+	}
+	return true
+}
+
+// IsTimeout 判断错误是否为从站没有响应（串口读超时或 TCP 超时）
+func IsTimeout(err error) bool {
+	var mbErr *ModbusError
+	if errors.As(err, &mbErr) {
+		return mbErr.ExceptionCode == ExceptionCodeGatewayTargetDeviceFailedToRespond
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"errors"
+	"go-oak/util"
+	"testing"
+	"time"
+)
+
+func TestHealthTracker(t *testing.T) {
+	now := time.Date(2022, 8, 1, 0, 0, 0, 0, time.Local)
+	h := newHealthTracker(HealthPolicy{FailureThreshold: 3, BaseBackoff: 2 * time.Second, MaxBackoff: 5 * time.Second})
+	h.now = func() time.Time { return now }
+	timeout := &ModbusError{FunctionCode: 3, ExceptionCode: ExceptionCodeGatewayTargetDeviceFailedToRespond}
+	state := func() StationHealth { return h.snapshot()[0] }
+	// fail 放行一个请求并记录失败
+	fail := func() {
+		t.Helper()
+		if err := h.allow(1); err != nil {
+			t.Fatal(err)
+		}
+		h.record(1, timeout)
+	}
+
+	// 异常码 11 以外的异常说明站点在线，不计入失败
+	for i := 0; i < 5; i++ {
+		_ = h.allow(1)
+		h.record(1, &ModbusError{FunctionCode: 3, ExceptionCode: ExceptionCodeIllegalDataAddress})
+	}
+	if s := state(); s.State != CircuitClosed || s.Failures != 0 || s.Successes != 5 {
+		t.Fatalf("异常响应后的状态 %+v", s)
+	}
+	// 端口掉线不计入统计
+	_ = h.allow(1)
+	h.record(1, util.ErrPortLost)
+	if s := state(); s.Failures != 0 {
+		t.Fatalf("端口掉线不应计入失败: %+v", s)
+	}
+
+	// 连续失败 3 次后熔断
+	fail()
+	fail()
+	if s := state(); s.State != CircuitClosed || s.ConsecutiveFailures != 2 {
+		t.Fatalf("失败 2 次后的状态 %+v", s)
+	}
+	fail()
+	if s := state(); s.State != CircuitOpen || !s.RetryAt.Equal(now.Add(2*time.Second)) {
+		t.Fatalf("失败 3 次后的状态 %+v", s)
+	}
+	if err := h.allow(1); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("熔断期间应该拒绝请求，得到 %v", err)
+	}
+
+	// 退避时间到后只放行一个探测请求
+	now = now.Add(2 * time.Second)
+	if err := h.allow(1); err != nil {
+		t.Fatal(err)
+	}
+	if state().State != CircuitHalfOpen {
+		t.Fatalf("探测时的状态 %v", state().State)
+	}
+	if err := h.allow(1); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("探测结果出来前应该拒绝其他请求，得到 %v", err)
+	}
+
+	// 探测失败时退避时间翻倍，不超过 MaxBackoff
+	h.record(1, timeout)
+	if s := state(); s.State != CircuitOpen || !s.RetryAt.Equal(now.Add(4*time.Second)) {
+		t.Fatalf("第一次探测失败后的状态 %+v", s)
+	}
+	now = now.Add(4 * time.Second)
+	fail()
+	if s := state(); !s.RetryAt.Equal(now.Add(5 * time.Second)) {
+		t.Fatalf("退避时间应该不超过 MaxBackoff: %+v", s)
+	}
+
+	// 探测成功后恢复
+	now = now.Add(5 * time.Second)
+	if err := h.allow(1); err != nil {
+		t.Fatal(err)
+	}
+	h.record(1, nil)
+	if s := state(); s.State != CircuitClosed || s.ConsecutiveFailures != 0 {
+		t.Fatalf("探测成功后的状态 %+v", s)
+	}
+	if err := h.allow(1); err != nil {
+		t.Fatal(err)
+	}
+	h.record(1, nil)
+	// 恢复后重新从 BaseBackoff 开始
+	fail()
+	fail()
+	fail()
+	if s := state(); !s.RetryAt.Equal(now.Add(2 * time.Second)) {
+		t.Fatalf("恢复后再次熔断的状态 %+v", s)
+	}
+}
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// MaskValue 按功能码 22 的规则计算写入后的值
+func MaskValue(current, andMask, orMask uint16) uint16 {
+	return current&andMask | orMask&^andMask
+}
+
+// MaskWrite 用 AND 和 OR 掩码修改保持寄存器。从站不支持功能码 22 时改为先读再写，
+// 读和写之间其他主站可能修改该寄存器，调用方需持有总线（例如在 poller.Poller.Do 中调用）。
+func MaskWrite(c Client, address, andMask, orMask uint16) (err error) {
+	_, err = c.MaskWriteRegister(address, andMask, orMask)
+	var mbErr *ModbusError
+	if !errors.As(err, &mbErr) || mbErr.ExceptionCode != ExceptionCodeIllegalFunction {
+		return
+	}
+	results, err := c.ReadHoldingRegisters(address, 1)
+	if err != nil {
+		return
+	}
+	if len(results) != 2 {
+		return fmt.Errorf("modbus: 响应长度 '%v' 与预期接收长度 '%v' 不匹配", len(results), 2)
+	}
+	current := binary.BigEndian.Uint16(results)
+	if value := MaskValue(current, andMask, orMask); value != current {
+		_, err = c.WriteSingleRegister(address, value)
+	}
+	return
+}
+
+// WriteBit 把保持寄存器的第 bit 位（0 为最低位）置 1 或清 0，其他位不变
+func WriteBit(c Client, address uint16, bit uint, on bool) error {
+	if bit > 15 {
+		return fmt.Errorf("modbus: 位 '%v' 必须在 '%v' 和 '%v' 之间", bit, 0, 15)
+	}
+	var orMask uint16
+	if on {
+		orMask = 1 << bit
+	}
+	return MaskWrite(c, address, ^uint16(1<<bit), orMask)
+}
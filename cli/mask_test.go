@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestMaskValue(t *testing.T) {
+	// 协议规范中的例子：当前值 0x12，AND 0xF2，OR 0x25，结果 0x17
+	tests := []struct{ current, and, or, want uint16 }{
+		{0x0012, 0x00F2, 0x0025, 0x0017},
+		{0x1234, 0xFFFF, 0x0000, 0x1234},
+		{0x1234, 0x0000, 0xABCD, 0xABCD},
+		{0x00FF, ^uint16(1 << 3), 0, 0x00F7},
+		{0x0000, ^uint16(1 << 15), 1 << 15, 0x8000},
+	}
+	for _, tt := range tests {
+		if got := MaskValue(tt.current, tt.and, tt.or); got != tt.want {
+			t.Errorf("MaskValue(%04X, %04X, %04X) = %04X，预期 %04X", tt.current, tt.and, tt.or, got, tt.want)
+		}
+	}
+}
+
+// registerServer 内存中的保持寄存器，mask 为 false 时不支持功能码 22
+type registerServer struct {
+	regs     map[uint16]uint16
+	mask     bool
+	requests []byte
+}
+
+func (s *registerServer) handle(functionCode byte, request []byte) ([]byte, error) {
+	s.requests = append(s.requests, functionCode)
+	address := binary.BigEndian.Uint16(request)
+	switch {
+	case functionCode == FuncCodeReadHoldingRegisters:
+		return []byte{2, byte(s.regs[address] >> 8), byte(s.regs[address])}, nil
+	case functionCode == FuncCodeWriteSingleRegister:
+		s.regs[address] = binary.BigEndian.Uint16(request[2:])
+		return request, nil
+	case functionCode == FuncCodeMaskWriteRegister && s.mask:
+		s.regs[address] = MaskValue(s.regs[address], binary.BigEndian.Uint16(request[2:]), binary.BigEndian.Uint16(request[4:]))
+		return request, nil
+	}
+	return nil, &ModbusError{FunctionCode: functionCode, ExceptionCode: ExceptionCodeIllegalFunction}
+}
+
+func TestWriteBit(t *testing.T) {
+	for _, mask := range []bool{true, false} {
+		s := &registerServer{regs: map[uint16]uint16{10: 0x00F0}, mask: mask}
+		c := newClient(&DefaultOptions().Mode, &loopbackPort{handler: s.handle}, 1)
+		if err := WriteBit(c, 10, 0, true); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteBit(c, 10, 4, false); err != nil {
+			t.Fatal(err)
+		}
+		if s.regs[10] != 0x00E1 {
+			t.Fatalf("支持功能码 22: %v，寄存器 %04X，预期 00E1", mask, s.regs[10])
+		}
+		want := []byte{FuncCodeMaskWriteRegister, FuncCodeMaskWriteRegister}
+		if !mask {
+			// 不支持功能码 22 时先读再写
+			want = []byte{22, 3, 6, 22, 3, 6}
+		}
+		if string(s.requests) != string(want) {
+			t.Fatalf("支持功能码 22: %v，请求的功能码 %v，预期 %v", mask, s.requests, want)
+		}
+	}
+
+	// 值没有变化时不写入
+	s := &registerServer{regs: map[uint16]uint16{10: 0x0001}}
+	c := newClient(&DefaultOptions().Mode, &loopbackPort{handler: s.handle}, 1)
+	if err := WriteBit(c, 10, 0, true); err != nil || string(s.requests) != string([]byte{22, 3}) {
+		t.Fatalf("值不变时的请求 %v, %v", s.requests, err)
+	}
+
+	// 其他异常不改为先读再写
+	c = newClient(&DefaultOptions().Mode, &loopbackPort{handler: func(functionCode byte, request []byte) ([]byte, error) {
+		return nil, &ModbusError{FunctionCode: functionCode, ExceptionCode: ExceptionCodeIllegalDataAddress}
+	}}, 1)
+	var mbErr *ModbusError
+	if err := WriteBit(c, 10, 0, true); !errors.As(err, &mbErr) || mbErr.ExceptionCode != ExceptionCodeIllegalDataAddress {
+		t.Fatalf("非法地址应该直接返回，得到 %v", err)
+	}
+	if err := WriteBit(c, 10, 16, true); err == nil {
+		t.Fatal("位 16 应该报错")
+	}
+}
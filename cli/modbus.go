@@ -1,6 +1,11 @@
 package cli
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
 
 // 功能码
 const (
@@ -13,6 +18,19 @@ const (
 	FuncCodeReadInputRegisters     = 4
 	FuncCodeWriteSingleRegister    = 6
 	FuncCodeWriteMultipleRegisters = 16
+	FuncCodeMaskWriteRegister      = 22
+	FuncCodeReadFIFOQueue          = 24
+
+	FuncCodeReadFileRecord  = 20 // 文件记录访问
+	FuncCodeWriteFileRecord = 21
+
+	FuncCodeReadExceptionStatus = 7 // 仅串行链路
+	FuncCodeDiagnostics         = 8 // 诊断，仅串行链路
+	FuncCodeGetCommEventCounter = 11
+	FuncCodeGetCommEventLog     = 12
+	FuncCodeReportServerId      = 17
+
+	FuncCodeEncapsulatedInterface = 43 // 封装接口，MEI 类型 14 为读设备标识
 )
 
 // 异常码
@@ -28,6 +46,9 @@ const (
 	ExceptionCodeGatewayTargetDeviceFailedToRespond = 11
 )
 
+// ErrChecksum 帧的 CRC 校验错误
+var ErrChecksum = errors.New("modbus: CRC 校验错误")
+
 // ModbusError 实现错误接口
 type ModbusError struct {
 	FunctionCode  byte
@@ -36,6 +57,11 @@ type ModbusError struct {
 
 // Error 转换已知的 Modbus 错误码为错误信息
 func (e *ModbusError) Error() string {
+	return fmt.Sprintf("modbus: exception '%v' (%s), function '%v'", e.ExceptionCode, e.exceptionName(), e.FunctionCode)
+}
+
+// exceptionName 返回异常码的名称
+func (e *ModbusError) exceptionName() string {
 	var name string
 	switch e.ExceptionCode {
 	case ExceptionCodeIllegalFunction:
@@ -59,7 +85,7 @@ func (e *ModbusError) Error() string {
 	default:
 		name = "unknown"
 	}
-	return fmt.Sprintf("modbus: exception '%v' (%s), function '%v'", e.ExceptionCode, name, e.FunctionCode)
+	return name
 }
 
 // ProtocolDataUnit (PDU) 独立于底层通信层 -> 功能码 + 数据
@@ -81,6 +107,12 @@ type Transporter interface {
 	Send(aduRequest []byte) (aduResponse []byte, err error)
 }
 
+// Port 指定客户端使用的端口，serial.Port 满足该接口
+type Port interface {
+	io.ReadWriteCloser
+	SetReadTimeout(t time.Duration) error
+}
+
 // Client 实现 Modbus 协议的客户端
 type Client interface {
 	// 1Bit 访问
@@ -108,10 +140,73 @@ type Client interface {
 	// WriteMultipleRegisters 写入一个连续寄存器块（1 到 123 个寄存器）并返回寄存器数量。
 	WriteMultipleRegisters(address, quantity uint16, value []byte) (results []byte, err error)
 
+	// MaskWriteRegister 用 AND 和 OR 掩码修改保持寄存器（功能码 22）：
+	// 结果 = (当前值 AND andMask) OR (orMask AND (NOT andMask))。返回响应中的两个掩码。
+	MaskWriteRegister(address, andMask, orMask uint16) (results []byte, err error)
+
+	// ReadFIFOQueue 读取 FIFO 队列（功能码 24），address 为队列计数寄存器的地址，
+	// 返回队列中的寄存器值（最多 31 个），不含计数
+	ReadFIFOQueue(address uint16) (results []byte, err error)
+
+	// ReadFileRecords 读取文件记录（功能码 20），一帧中可以有多个子请求，
+	// 返回的 FileRecord 与请求一一对应并填入 Data
+	ReadFileRecords(records []FileRecord) (results []FileRecord, err error)
+	// WriteFileRecords 写入文件记录（功能码 21），每个子请求写入 Data 中的寄存器
+	WriteFileRecords(records []FileRecord) (err error)
+
 	// ReadWriteMultipleRegisters 执行一次读取操作和一次写入操作的组合。 它返回读取的寄存器值。
 	ReadWriteMultipleRegisters(readAddress, readQuantity, writeAddress, writeQuantity uint16, value []byte) (results []byte, err error)
 
+	// 诊断
+
+	// Diagnostics 诊断（功能码 08），subFunction 为 DiagReturnQueryData 等子功能码，
+	// 返回响应中子功能码之后的数据。进入只听模式时从站不响应，不算错误。
+	Diagnostics(subFunction uint16, data []byte) (results []byte, err error)
+	// GetCommEventCounter 读取通信事件计数器（功能码 11），status 为 0xFFFF 表示从站正忙
+	GetCommEventCounter() (status, eventCount uint16, err error)
+	// GetCommEventLog 读取通信事件日志（功能码 12）
+	GetCommEventLog() (results *CommEventLog, err error)
+
+	// 设备标识
+
+	// ReadExceptionStatus 读取 8 个异常状态位（功能码 07），各位的含义由设备定义
+	ReadExceptionStatus() (status byte, err error)
+	// ReportServerId 读取从站 ID 和运行状态（功能码 17），ID 按一个字节解析。
+	// ID 更长时 results 只有 Raw（Id 为 nil），用 ParseServerId 按实际长度解析
+	ReportServerId() (results *ServerId, err error)
+	// ReadDeviceIdentification 读设备标识（功能码 43 / MEI 类型 14）。readDeviceIdCode 为
+	// ReadDeviceIdBasic 等访问类型，从 objectId 开始读取，响应分多帧时自动读取后续帧。
+	ReadDeviceIdentification(readDeviceIdCode, objectId byte) (results *DeviceIdentification, err error)
+
+	// 自定义功能码
+
+	// RegisterFunction 注册自定义或厂商私有的功能码
+	RegisterFunction(f *Function) error
+	// Call 发送已注册的自定义功能码，data 为功能码之后的数据，返回 Function.Decode 的结果
+	Call(functionCode byte, data []byte) (results []byte, err error)
+
+	// SetSlaveId 设置站号。RTU 下站号 0 为广播地址，不能用于普通请求；
+	// TCP 下站号 0 是访问服务器本身的普通站号
 	SetSlaveId(id byte)
+	// SetBroadcast 开启或关闭广播，开启后写请求发往 BroadcastId，从站不响应。
+	// 只用于 RTU，TCP 连接开启时返回错误
+	SetBroadcast(on bool) error
+	// SlaveId 返回当前的站号
+	SlaveId() byte
+	// PortName 返回连接的串口名或 TCP 服务器地址
+	PortName() string
+
+	// SetTurnaroundDelay 设置广播后等待从站处理的时间
+	SetTurnaroundDelay(d time.Duration)
+
+	// SetFrameLogger 设置记录收发原始帧的 FrameLogger，nil 表示不记录
+	SetFrameLogger(logger FrameLogger)
+
+	// Health 返回每个站点的通信健康状态，连续失败的站点会被熔断
+	Health() []StationHealth
+	// SetHealthPolicy 设置熔断阈值和探测退避时间
+	SetHealthPolicy(policy HealthPolicy)
+
 	// Close 关闭 Client
 	Close() (cErr error)
 
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"time"
+
+	"go.bug.st/serial"
+)
+
+// Options 客户端连接参数
+type Options struct {
+	// Port 串口选择器，格式见 util.PortInfo.Match，为空时使用第一个串口
+	Port string
+	// Address Modbus TCP 服务器地址 host:port，非空时使用 TCP 而不是串口
+	Address string
+	// Mode 串口参数
+	Mode serial.Mode
+	// Timeout TCP 连接超时，以及 TCP 和串口等待从站响应的超时
+	Timeout time.Duration
+	// ScanFrom, ScanTo 扫描站号的范围
+	ScanFrom byte
+	ScanTo   byte
+	// TurnaroundDelay 广播后等待从站处理的时间
+	TurnaroundDelay time.Duration
+	// SlaveIdRegister 更改站号时写入的保持寄存器偏移（从 0 开始）
+	SlaveIdRegister uint16
+	// FrameLogger 记录收发的原始帧，nil 表示不记录
+	FrameLogger FrameLogger
+	// Record 非 nil 时把端口上的读写录制下来
+	Record *CaptureWriter
+	// Replay 非 nil 时不连接硬件，回放录制的会话
+	Replay *ReplayPort
+}
+
+// DefaultTimeout 默认的连接和响应超时
+const DefaultTimeout = time.Second
+
+// DefaultSlaveIdRegister 保存站号的默认保持寄存器偏移，即 Modicon 地址 40258
+const DefaultSlaveIdRegister = 257
+
+// DefaultOptions 返回默认连接参数：9600 8N1，扫描站号 1-20
+func DefaultOptions() *Options {
+	return &Options{
+		Mode: serial.Mode{
+			BaudRate: 9600,
+			Parity:   serial.NoParity,
+			DataBits: 8,
+			StopBits: serial.OneStopBit,
+		},
+		Timeout:         DefaultTimeout,
+		TurnaroundDelay: DefaultTurnaroundDelay,
+		ScanFrom:        1,
+		ScanTo:          numSlavesScan,
+		SlaveIdRegister: DefaultSlaveIdRegister,
+	}
+}
+
+// IsTCP 是否使用 Modbus TCP 连接
+func (o *Options) IsTCP() bool {
+	return o.Address != ""
+}
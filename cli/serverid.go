@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// 运行状态
+const (
+	RunIndicatorOff = 0x00
+	RunIndicatorOn  = 0xFF
+)
+
+// ServerId 功能码 17 的响应。ID 的长度和附加数据的内容由设备定义
+type ServerId struct {
+	// Id 从站 ID，为 nil 时表示无法确定 ID 的长度，只有 Raw 有效
+	Id []byte
+	// Run 运行状态是否为 ON
+	Run bool
+	// Additional 运行状态之后的附加数据，通常是型号、版本等 ASCII 字符串
+	Additional []byte
+	// Raw 字节数之后的全部数据
+	Raw []byte
+}
+
+// ParseServerId 按 idLength 个字节的 ID 解析功能码 17 的响应数据（字节数之后的部分）
+func ParseServerId(raw []byte, idLength int) (results *ServerId, err error) {
+	if idLength < 1 || len(raw) < idLength+1 {
+		err = fmt.Errorf("modbus: 从站 ID 长度 '%v' 与响应长度 '%v' 不匹配", idLength, len(raw))
+		return
+	}
+	switch raw[idLength] {
+	case RunIndicatorOff, RunIndicatorOn:
+	default:
+		err = fmt.Errorf("modbus: 运行状态 '%v' 必须是 0x00 或 0xFF", raw[idLength])
+		return
+	}
+	results = &ServerId{
+		Id:         raw[:idLength],
+		Run:        raw[idLength] == RunIndicatorOn,
+		Additional: raw[idLength+1:],
+		Raw:        raw,
+	}
+	return
+}
+
+func (s *ServerId) String() string {
+	if s.Id == nil {
+		return fmt.Sprintf("raw=% X", s.Raw)
+	}
+	run := "OFF"
+	if s.Run {
+		run = "ON"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "id=% X run=%s", s.Id, run)
+	switch text := strings.TrimRight(string(s.Additional), "\x00 "); {
+	case text == "":
+	case isPrintable(text):
+		fmt.Fprintf(&b, " %q", text)
+	default:
+		fmt.Fprintf(&b, " data=% X", s.Additional)
+	}
+	return b.String()
+}
+
+// isPrintable 是否全部为可打印的 ASCII 字符
+func isPrintable(s string) bool {
+	for _, r := range s {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (cli *client) ReportServerId() (results *ServerId, err error) {
+	request := ProtocolDataUnit{FunctionCode: FuncCodeReportServerId}
+	response, err := cli.send(&request)
+	if err != nil {
+		return
+	}
+	count := int(response.Data[0])
+	length := len(response.Data) - 1
+	if count != length {
+		err = fmt.Errorf("modbus: 响应长度 '%v' 不匹配实际接收长度 '%v'", length, count)
+		return
+	}
+	raw := response.Data[1:]
+	if results, err = ParseServerId(raw, 1); err != nil {
+		// ID 不是一个字节，无法确定运行状态的位置，由调用方按设备的 ID 长度解析 Raw
+		return &ServerId{Raw: raw}, nil
+	}
+	return
+}
+
+func (cli *client) ReadExceptionStatus() (status byte, err error) {
+	request := ProtocolDataUnit{FunctionCode: FuncCodeReadExceptionStatus}
+	response, err := cli.send(&request)
+	if err != nil {
+		return
+	}
+	if len(response.Data) != 1 {
+		err = fmt.Errorf("modbus: 响应长度 '%v' 与预期接收长度 '%v' 不匹配", len(response.Data), 1)
+		return
+	}
+	return response.Data[0], nil
+}
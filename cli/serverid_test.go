@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"bytes"
+	"go-oak/util"
+	"testing"
+)
+
+// rtuFrame 在 PDU 前后加上站号和 CRC
+func rtuFrame(slaveId byte, pdu ...byte) []byte {
+	adu := append([]byte{slaveId}, pdu...)
+	crc := util.CheckSum(adu)
+	return append(adu, byte(crc), byte(crc>>8))
+}
+
+func TestReportServerIdLongId(t *testing.T) {
+	// 两个字节的 ID 'A' 'B'，运行状态 ON，附加数据 "v2"
+	raw := []byte{'A', 'B', RunIndicatorOn, 'v', '2'}
+	port := &scriptedPort{reads: [][]byte{rtuFrame(1, append([]byte{FuncCodeReportServerId, byte(len(raw))}, raw...)...)}}
+	c := newClient(&DefaultOptions().Mode, port, 1)
+	id, err := c.ReportServerId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Id != nil || !bytes.Equal(id.Raw, raw) {
+		t.Fatalf("ID 不是一个字节时应该只返回 Raw: %+v", id)
+	}
+	if id, err = ParseServerId(id.Raw, 2); err != nil || string(id.Id) != "AB" || !id.Run || string(id.Additional) != "v2" {
+		t.Fatalf("按两个字节解析: %+v, %v", id, err)
+	}
+}
@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"fmt"
+	"go-oak/util"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+// minSnifferSilence USB 转串口会把数据攒成块再交给系统，
+// 按 3.5 字符时间判断帧间隔会把一帧拆开，所以静默时间至少取这么长
+const minSnifferSilence = 20 * time.Millisecond
+
+// Transaction 监听到的一次请求和响应
+type Transaction struct {
+	Request *Frame
+	// Response 为 nil 表示超时没有响应（或广播请求）
+	Response *Frame
+}
+
+func (t *Transaction) String() string {
+	s := fmt.Sprintf("%s %v", t.Request.Time.Format("15:04:05.000"), t.Request.Summary)
+	if t.Request.Err != nil {
+		s += " error: " + t.Request.Err.Error()
+	}
+	if t.Response == nil {
+		return s + " -> 无响应"
+	}
+	s += fmt.Sprintf(" -> %v (%v)", t.Response.Summary, t.Response.Latency.Round(time.Millisecond))
+	if t.Response.Err != nil {
+		s += " error: " + t.Response.Err.Error()
+	}
+	return s
+}
+
+// Sniffer 被动监听 RS-485 总线上其他主站（PLC、HMI 等）与从站的通信。
+// 只读取端口，从不发送数据。按静默时间切分字节流，
+// 再用 CRC 校验把粘在一起的帧分开，并把请求和响应配对。
+type Sniffer struct {
+	// Silence 帧间静默时间
+	Silence time.Duration
+	// Timeout 请求发出后等待响应的最长时间
+	Timeout time.Duration
+	// FrameLogger 记录监听到的每一帧，可以为 nil
+	FrameLogger FrameLogger
+
+	port    Port
+	name    string
+	pending *Frame
+}
+
+// NewSniffer 在已打开的端口上创建 Sniffer，name 为记录帧时使用的端口名
+func NewSniffer(port Port, name string, mode *serial.Mode) *Sniffer {
+	silence := 1750 * time.Microsecond
+	if mode.BaudRate > 0 && mode.BaudRate <= 19200 {
+		silence = time.Duration(35000000/mode.BaudRate) * time.Microsecond
+	}
+	if silence < minSnifferSilence {
+		silence = minSnifferSilence
+	}
+	return &Sniffer{
+		Silence: silence,
+		Timeout: time.Second,
+		port:    port,
+		name:    name,
+	}
+}
+
+// Run 持续监听，每配对完成一次请求/响应就调用 handler，直到端口出错
+func (s *Sniffer) Run(handler func(t *Transaction)) (err error) {
+	if err = s.port.SetReadTimeout(s.Silence); err != nil {
+		return
+	}
+	buf := make([]byte, 0, rtuMaxSize*2)
+	chunk := make([]byte, rtuMaxSize)
+	var last time.Time
+	for {
+		n, err := s.port.Read(chunk)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			buf = append(buf, chunk[:n]...)
+			last = time.Now()
+			if len(buf) < rtuMaxSize {
+				continue
+			}
+		}
+		if len(buf) > 0 {
+			for _, raw := range SplitRTUFrames(buf) {
+				s.frame(raw, last, handler)
+			}
+			buf = buf[:0]
+		}
+		if s.pending != nil && time.Since(s.pending.Time) > s.Timeout {
+			handler(&Transaction{Request: s.pending})
+			s.pending = nil
+		}
+	}
+}
+
+// frame 处理一帧：与未完成的请求匹配则作为响应，否则作为新的请求
+func (s *Sniffer) frame(raw []byte, at time.Time, handler func(t *Transaction)) {
+	f := &Frame{
+		Direction: DirectionTX,
+		Time:      at,
+		Port:      s.name,
+		Protocol:  ProtocolRTU,
+		Raw:       append([]byte(nil), raw...),
+	}
+	if !checkRTU(raw) {
+		f.Err = ErrChecksum
+	}
+	if p := s.pending; p != nil && len(raw) >= 2 && len(p.Raw) >= 2 &&
+		raw[0] == p.Raw[0] && raw[1]&^0x80 == p.Raw[1] {
+		f.Direction = DirectionRX
+		f.Latency = at.Sub(p.Time)
+		f.Summary = SummarizeADU(ProtocolRTU, raw, false)
+		s.log(f)
+		handler(&Transaction{Request: p, Response: f})
+		s.pending = nil
+		return
+	}
+	if s.pending != nil {
+		handler(&Transaction{Request: s.pending})
+	}
+	f.Summary = SummarizeADU(ProtocolRTU, raw, true)
+	s.log(f)
+	s.pending = f
+}
+
+func (s *Sniffer) log(f *Frame) {
+	if s.FrameLogger != nil {
+		s.FrameLogger.LogFrame(f)
+	}
+}
+
+// checkRTU 校验 RTU 帧的 CRC
+func checkRTU(adu []byte) bool {
+	length := len(adu)
+	if length < rtuMinSize {
+		return false
+	}
+	checksum := uint16(adu[length-1])<<8 | uint16(adu[length-2])
+	return checksum == util.CheckSum(adu[:length-2])
+}
+
+// SplitRTUFrames 用 CRC 把一段字节流切分成 RTU 帧。从头开始找最短的 CRC 正确的前缀作为一帧，
+// 剩余部分找不到 CRC 正确的帧时整体作为一个（校验错误的）帧返回。
+func SplitRTUFrames(data []byte) (frames [][]byte) {
+	for len(data) > 0 {
+		n := len(data)
+		for i := rtuMinSize; i <= len(data) && i <= rtuMaxSize; i++ {
+			if checkRTU(data[:i]) {
+				n = i
+				break
+			}
+		}
+		frames = append(frames, data[:n])
+		data = data[n:]
+	}
+	return
+}
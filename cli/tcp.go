@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+const (
+	tcpProtocolIdentifier = 0x0000
+	tcpHeaderSize         = 7 // MBAP 头：事务号(2) + 协议号(2) + 长度(2) + 单元号(1)
+	tcpMaxLength          = 260
+)
+
+// NewTCPClient 连接 Modbus TCP 服务器（address 为 host:port）
+func NewTCPClient(address string, timeout time.Duration, slaveId byte) (Client, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return newTCPClient(&tcpPort{Conn: conn}, timeout, slaveId), nil
+}
+
+// newTCPClient 在已连接的端口上创建 Modbus TCP 客户端
+func newTCPClient(port Port, timeout time.Duration, slaveId byte) *client {
+	cli := newClient(&serial.Mode{}, port, slaveId)
+	t := &tcpTransporter{cli: cli, port: port, timeout: timeout}
+	cli.packager = t
+	cli.transporter = t
+	cli.protocol = ProtocolTCP
+	return cli
+}
+
+// tcpPort 把 net.Conn 适配成 Port
+type tcpPort struct {
+	net.Conn
+}
+
+func (p *tcpPort) SetReadTimeout(t time.Duration) error {
+	if t < 0 {
+		return p.SetReadDeadline(time.Time{})
+	}
+	return p.SetReadDeadline(time.Now().Add(t))
+}
+
+// tcpTransporter 实现 Modbus TCP 的 Packager 和 Transporter
+type tcpTransporter struct {
+	cli           *client
+	port          Port
+	timeout       time.Duration
+	transactionId uint32
+}
+
+// Encode 在 PDU 前添加 MBAP 头
+func (t *tcpTransporter) Encode(pdu *ProtocolDataUnit) (adu []byte, err error) {
+	adu = make([]byte, tcpHeaderSize+1+len(pdu.Data))
+	if len(adu) > tcpMaxLength {
+		err = fmt.Errorf("modbus: 数据 '%v' 的长度不能大于 '%v'", len(adu), tcpMaxLength)
+		return
+	}
+	id := atomic.AddUint32(&t.transactionId, 1)
+	binary.BigEndian.PutUint16(adu, uint16(id))
+	binary.BigEndian.PutUint16(adu[2:], tcpProtocolIdentifier)
+	binary.BigEndian.PutUint16(adu[4:], uint16(len(adu)-6))
+	adu[6] = t.cli.slaveId
+	adu[7] = pdu.FunctionCode
+	copy(adu[8:], pdu.Data)
+	return
+}
+
+// Verify 验证事务号、协议号和单元号是否与请求一致
+func (t *tcpTransporter) Verify(aduRequest []byte, aduResponse []byte) (err error) {
+	if len(aduResponse) < tcpHeaderSize+1 {
+		err = fmt.Errorf("modbus: 响应长度 '%v' 低于最小长度 '%v'", len(aduResponse), tcpHeaderSize+1)
+		return
+	}
+	if reqId, respId := binary.BigEndian.Uint16(aduRequest), binary.BigEndian.Uint16(aduResponse); reqId != respId {
+		err = fmt.Errorf("modbus: 响应事务号 '%v' 与请求事务号 '%v' 不匹配", respId, reqId)
+		return
+	}
+	if protocol := binary.BigEndian.Uint16(aduResponse[2:]); protocol != tcpProtocolIdentifier {
+		err = fmt.Errorf("modbus: 响应协议号 '%v' 与预期 '%v' 不匹配", protocol, tcpProtocolIdentifier)
+		return
+	}
+	if aduResponse[6] != aduRequest[6] {
+		err = fmt.Errorf("modbus: 响应的单元号 '%v' 与请求单元号 '%v' 不匹配", aduResponse[6], aduRequest[6])
+		return
+	}
+	return
+}
+
+// Decode 去掉 MBAP 头，返回 PDU
+func (t *tcpTransporter) Decode(adu []byte) (pdu *ProtocolDataUnit, err error) {
+	if length := int(binary.BigEndian.Uint16(adu[4:])); length != len(adu)-6 {
+		err = fmt.Errorf("modbus: MBAP 长度 '%v' 与实际长度 '%v' 不匹配", length, len(adu)-6)
+		return
+	}
+	pdu = &ProtocolDataUnit{
+		FunctionCode: adu[7],
+		Data:         adu[8:],
+	}
+	return
+}
+
+// Send 发送帧，读取 MBAP 头后按其中的长度读取剩余部分，直到收到事务号相同的响应
+func (t *tcpTransporter) Send(aduRequest []byte) (aduResponse []byte, err error) {
+	if err = t.port.SetReadTimeout(t.timeout); err != nil {
+		return
+	}
+	if _, err = t.port.Write(aduRequest); err != nil {
+		return
+	}
+	header := make([]byte, tcpHeaderSize)
+	for {
+		if _, err = io.ReadFull(t.port, header); err != nil {
+			return
+		}
+		length := int(binary.BigEndian.Uint16(header[4:]))
+		if length <= 1 || length+6 > tcpMaxLength {
+			err = fmt.Errorf("modbus: MBAP 长度 '%v' 不合法", length)
+			return
+		}
+		aduResponse = make([]byte, length+6)
+		copy(aduResponse, header)
+		if _, err = io.ReadFull(t.port, aduResponse[tcpHeaderSize:]); err != nil {
+			return
+		}
+		// 网关对广播或已超时的请求可能之后才响应，丢弃事务号不同的旧响应
+		if binary.BigEndian.Uint16(aduResponse) == binary.BigEndian.Uint16(aduRequest) {
+			return
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package cli
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Direction 帧的方向
+type Direction int
+
+const (
+	DirectionTX Direction = iota // 主站发出的请求
+	DirectionRX                  // 从站返回的响应
+)
+
+func (d Direction) String() string {
+	if d == DirectionTX {
+		return "TX"
+	}
+	return "RX"
+}
+
+// 帧格式
+const (
+	ProtocolRTU = "rtu"
+	ProtocolTCP = "tcp"
+)
+
+// Frame 收发的一帧原始数据
+type Frame struct {
+	Direction Direction
+	Time      time.Time
+	// Port 串口名或 TCP 服务器地址
+	Port     string
+	Protocol string
+	Raw      []byte
+	Summary  Summary
+	// Latency RX 帧从发出请求到收到响应的时间
+	Latency time.Duration
+	// Err RX 帧的接收错误（超时、CRC 错误等），此时 Raw 可能为空
+	Err error
+}
+
+// Summary 帧的解码摘要
+type Summary struct {
+	UnitId       byte
+	FunctionCode byte
+	// HasAddress 请求或写响应中是否包含地址和数量（值）
+	HasAddress bool
+	Address    uint16
+	// Quantity 读写数量，写单个线圈或寄存器时为写入的值
+	Quantity  uint16
+	ByteCount int
+	// Exception 是否为异常响应
+	Exception     bool
+	ExceptionCode byte
+}
+
+func (s Summary) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "unit=%d fc=%02X", s.UnitId, s.FunctionCode)
+	if name := FunctionName(s.FunctionCode &^ 0x80); name != "" {
+		fmt.Fprintf(&b, "(%s)", name)
+	}
+	if s.Exception {
+		fmt.Fprintf(&b, " exception=%d", s.ExceptionCode)
+		if name := (&ModbusError{ExceptionCode: s.ExceptionCode}).exceptionName(); name != "unknown" {
+			fmt.Fprintf(&b, "(%s)", name)
+		}
+		return b.String()
+	}
+	if s.HasAddress {
+		fmt.Fprintf(&b, " addr=%d", s.Address)
+		switch s.FunctionCode {
+		case FuncCodeWriteSingleCoil, FuncCodeWriteSingleRegister:
+			fmt.Fprintf(&b, " value=%d", s.Quantity)
+		default:
+			fmt.Fprintf(&b, " count=%d", s.Quantity)
+		}
+	}
+	if s.ByteCount > 0 {
+		fmt.Fprintf(&b, " bytes=%d", s.ByteCount)
+	}
+	return b.String()
+}
+
+// FunctionName 返回功能码名称，未知功能码返回空字符串
+func FunctionName(code byte) string {
+	switch code {
+	case FuncCodeReadCoils:
+		return "read coils"
+	case FuncCodeReadDiscreteInputs:
+		return "read discrete inputs"
+	case FuncCodeWriteSingleCoil:
+		return "write single coil"
+	case FuncCodeWriteMultipleCoils:
+		return "write multiple coils"
+	case FuncCodeReadHoldingRegisters:
+		return "read holding registers"
+	case FuncCodeReadInputRegisters:
+		return "read input registers"
+	case FuncCodeWriteSingleRegister:
+		return "write single register"
+	case FuncCodeWriteMultipleRegisters:
+		return "write multiple registers"
+	case FuncCodeMaskWriteRegister:
+		return "mask write register"
+	case FuncCodeReadFIFOQueue:
+		return "read fifo queue"
+	case FuncCodeReadFileRecord:
+		return "read file record"
+	case FuncCodeWriteFileRecord:
+		return "write file record"
+	case FuncCodeReadExceptionStatus:
+		return "read exception status"
+	case FuncCodeDiagnostics:
+		return "diagnostics"
+	case FuncCodeGetCommEventCounter:
+		return "get comm event counter"
+	case FuncCodeGetCommEventLog:
+		return "get comm event log"
+	case FuncCodeReportServerId:
+		return "report server id"
+	case FuncCodeEncapsulatedInterface:
+		return "encapsulated interface"
+	}
+	return ""
+}
+
+// Summarize 解码 PDU 的摘要，request 表示是否为请求帧
+func Summarize(unitId byte, pdu []byte, request bool) (s Summary) {
+	s.UnitId = unitId
+	if len(pdu) == 0 {
+		return
+	}
+	s.FunctionCode = pdu[0]
+	data := pdu[1:]
+	if s.FunctionCode&0x80 != 0 {
+		s.Exception = true
+		if len(data) > 0 {
+			s.ExceptionCode = data[0]
+		}
+		return
+	}
+	switch s.FunctionCode {
+	case FuncCodeReadCoils, FuncCodeReadDiscreteInputs,
+		FuncCodeReadHoldingRegisters, FuncCodeReadInputRegisters:
+		if request {
+			s.addressBlock(data)
+		} else if len(data) > 0 {
+			s.ByteCount = int(data[0])
+		}
+	case FuncCodeWriteSingleCoil, FuncCodeWriteSingleRegister:
+		s.addressBlock(data)
+	case FuncCodeWriteMultipleCoils, FuncCodeWriteMultipleRegisters:
+		s.addressBlock(data)
+		if request && len(data) > 4 {
+			s.ByteCount = int(data[4])
+		}
+	}
+	return
+}
+
+func (s *Summary) addressBlock(data []byte) {
+	if len(data) < 4 {
+		return
+	}
+	s.HasAddress = true
+	s.Address = binary.BigEndian.Uint16(data)
+	s.Quantity = binary.BigEndian.Uint16(data[2:])
+}
+
+// SummarizeADU 按帧格式解码 ADU 的摘要
+func SummarizeADU(protocol string, adu []byte, request bool) Summary {
+	switch protocol {
+	case ProtocolTCP:
+		if len(adu) > tcpHeaderSize {
+			return Summarize(adu[6], adu[tcpHeaderSize:], request)
+		}
+	default:
+		if len(adu) >= rtuMinSize {
+			return Summarize(adu[0], adu[1:len(adu)-2], request)
+		}
+	}
+	return Summary{}
+}
+
+// FrameLogger 记录客户端收发的原始帧
+type FrameLogger interface {
+	LogFrame(f *Frame)
+}
+
+// FrameLoggers 把帧依次交给多个 FrameLogger
+type FrameLoggers []FrameLogger
+
+func (ls FrameLoggers) LogFrame(f *Frame) {
+	for _, l := range ls {
+		l.LogFrame(f)
+	}
+}
+
+// textLogger 以文本形式输出十六进制帧
+type textLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewTextLogger 返回以文本形式把帧写入 w 的 FrameLogger，每帧一行：
+//
+//	16:04:05.123 /dev/ttyUSB0 TX 06 04 00 01 00 02 20 7C | unit=6 fc=04(read input registers) addr=1 count=2
+func NewTextLogger(w io.Writer) FrameLogger {
+	return &textLogger{w: w}
+}
+
+func (l *textLogger) LogFrame(f *Frame) {
+	line := fmt.Sprintf("%s %s %v % X | %v", f.Time.Format("15:04:05.000"), f.Port, f.Direction, f.Raw, f.Summary)
+	if f.Direction == DirectionRX {
+		line += fmt.Sprintf(" (%v)", f.Latency.Round(time.Microsecond))
+	}
+	if f.Err != nil {
+		line += " error: " + f.Err.Error()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintln(l.w, line)
+}
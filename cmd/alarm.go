@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-oak/alarm"
+	"go-oak/poller"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyFile string
+	// historyMaxSize 报警历史文件的大小上限，单位 MB
+	historyMaxSize int
+)
+
+// alarmCmd represents the alarm command
+var alarmCmd = &cobra.Command{
+	Use:   "alarm",
+	Short: "轮询配置文件中的设备，按报警规则检查并通知",
+	Long: `按 --interval 轮询配置文件中所有设备的可读点位，按配置文件中的 alarms 检查，
+报警和恢复时按 notifiers 通知，并记录到 --history 文件。例如：
+
+  alarms:
+    - {name: 冷库温度高, device: th01, tag: temperature, type: high, limit: 8, hysteresis: 0.5, delay: 5m}
+    - {name: 冷库温度变化快, device: th01, tag: temperature, type: rate, limit: 2}
+    - {name: 传感器卡死, device: th01, tag: humidity, type: stale, timeout: 30m}
+    - {name: 通信中断, device: th01, type: comm, delay: 1m}
+  notifiers:
+    - {type: log}
+    - {type: webhook, url: "http://localhost:9000/alarm"}
+    - {type: exec, command: [/usr/local/bin/send-sms.sh]}
+
+type 可以是 high/low（上下限）、rate（每分钟变化量）、stale（值长时间不变）、comm（通信失败）。`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(cfg.Alarms) == 0 {
+			log.Fatal(errors.New("配置文件中没有报警规则"))
+		}
+		history, err := alarm.NewHistory(historyFile, 1000)
+		if err != nil {
+			log.Fatal(err)
+		}
+		history.MaxSize = int64(historyMaxSize) << 20
+		engine, err := alarm.NewEngine(cfg.Alarms, history)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(cfg.Notifiers) == 0 {
+			engine.AddNotifier(&alarm.LogNotifier{})
+		}
+		for _, c := range cfg.Notifiers {
+			n, err := alarm.NewNotifier(c)
+			if err != nil {
+				log.Fatal(err)
+			}
+			engine.AddNotifier(n)
+		}
+
+		p, err := newPoller(cmd, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer p.Close()
+		p.Handle(engine.HandleReading)
+		log.Printf("按 %d 条报警规则监视 %d 台设备", len(cfg.Alarms), len(p.Database().Devices()))
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go engine.Run(ctx)
+		_ = p.Run(ctx)
+	},
+}
+
+// alarmHistoryCmd represents the alarm history command
+var alarmHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "显示报警历史",
+	Run: func(cmd *cobra.Command, args []string) {
+		if historyFile == "" {
+			log.Fatal(errors.New("请用 --history 指定报警历史文件"))
+		}
+		history, err := alarm.NewHistory(historyFile, 0)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, e := range history.Events() {
+			fmt.Println(e.Time.Format("2006-01-02 15:04:05"), e)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(alarmCmd)
+	alarmCmd.AddCommand(alarmHistoryCmd)
+	alarmCmd.PersistentFlags().StringVar(&historyFile, "history", "", "把报警历史追加到文件")
+	alarmCmd.Flags().IntVar(&historyMaxSize, "history-max-size", alarm.DefaultHistoryMaxSize>>20,
+		"报警历史文件的大小上限（MB），超过后改名为 <文件>.1 并新建文件，0 表示不限制")
+	alarmCmd.Flags().DurationVar(&pollInterval, "interval", poller.DefaultInterval, "轮询间隔")
+}
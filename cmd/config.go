@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"fmt"
+	"go-oak/cli"
+	"go-oak/config"
+	"go-oak/pcap"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// envPrefix 环境变量前缀，例如 GO_OAK_BAUD 对应 --baud
+const envPrefix = "GO_OAK_"
+
+var (
+	cfgFile        string
+	connectionName string
+	deviceName     string
+	baudRate       int
+	parity         string
+	dataBits       int
+	stopBits       string
+	tcpAddress     string
+	turnaround     time.Duration
+	trace          bool
+	traceFile      string
+	pcapFile       string
+	recordFile     string
+	replayFile     string
+	replayRealtime bool
+
+	// cfg 已加载的配置文件，没有配置文件时为空配置
+	cfg = &config.Config{}
+)
+
+// loadConfig 加载配置文件，并用环境变量填充命令行中未指定的参数。
+// 优先级：命令行参数 > 环境变量 > 配置文件 > 默认值。
+func loadConfig(cmd *cobra.Command) (err error) {
+	applyEnv(cmd.Flags())
+	path := cfgFile
+	if path == "" {
+		path = config.Find()
+	}
+	if path == "" {
+		return
+	}
+	loaded, err := config.Load(path)
+	if err != nil {
+		return
+	}
+	cfg = loaded
+	return
+}
+
+// applyEnv 对没有在命令行中指定的参数，使用对应的环境变量
+func applyEnv(flags *pflag.FlagSet) {
+	flags.VisitAll(func(f *pflag.Flag) {
+		if f.Changed {
+			return
+		}
+		env := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if v, ok := os.LookupEnv(env); ok {
+			_ = flags.Set(f.Name, v)
+		}
+	})
+}
+
+// clientOptions 根据配置文件中的连接和命令行参数生成连接参数
+func clientOptions(cmd *cobra.Command) (opts *cli.Options, err error) {
+	name := connectionName
+	if name == "" && deviceName != "" {
+		var dev *config.Device
+		if dev, err = cfg.Device(deviceName); err != nil {
+			return
+		}
+		name = dev.Connection
+	}
+	return connectionOptions(cmd, name, true)
+}
+
+// busOptions 生成 Poller 中某条总线的连接参数。命令行参数和环境变量只用于
+// --connection 选择的连接或默认连接，不会让所有总线都使用同一个端口
+func busOptions(cmd *cobra.Command, name string) (opts *cli.Options, err error) {
+	selected := cfg.ConnectionName(name) == cfg.ConnectionName(connectionName)
+	return connectionOptions(cmd, name, selected)
+}
+
+// connectionOptions 根据配置文件中指定名称的连接和命令行参数生成连接参数，
+// 名称为空时使用默认连接。override 为 false 时不使用命令行参数
+func connectionOptions(cmd *cobra.Command, name string, override bool) (opts *cli.Options, err error) {
+	conn, err := cfg.Connection(name)
+	if err != nil {
+		return
+	}
+	// 复制一份，命令行参数不修改配置本身
+	c := *conn
+	if override {
+		applyFlags(cmd, &c)
+	}
+	if opts, err = c.Options(); err != nil {
+		return
+	}
+	s, err := openSession()
+	if err != nil {
+		return
+	}
+	opts.FrameLogger, opts.Record, opts.Replay = s.logger, s.record, s.replay
+	return
+}
+
+// applyFlags 用命令行中指定的参数（包括环境变量）覆盖连接配置
+func applyFlags(cmd *cobra.Command, c *config.Connection) {
+	flags := cmd.Flags()
+	if flags.Changed("port") {
+		c.Type, c.Port = "serial", portSelector
+	}
+	if flags.Changed("address") {
+		c.Type, c.Address = "tcp", tcpAddress
+	}
+	if flags.Changed("baud") {
+		c.BaudRate = baudRate
+	}
+	if flags.Changed("parity") {
+		c.Parity = parity
+	}
+	if flags.Changed("data-bits") {
+		c.DataBits = dataBits
+	}
+	if flags.Changed("stop-bits") {
+		c.StopBits = stopBits
+	}
+	if flags.Changed("turnaround") {
+		c.TurnaroundDelay = turnaround
+	}
+}
+
+// session 整个进程共用的跟踪、录制和回放文件，多个连接写入同一组文件
+type session struct {
+	logger cli.FrameLogger
+	record *cli.CaptureWriter
+	replay *cli.ReplayPort
+}
+
+var (
+	sessionOnce sync.Once
+	sessionErr  error
+	current     session
+)
+
+// openSession 按 --trace、--record、--replay 等参数打开文件，只在第一次调用时打开
+func openSession() (*session, error) {
+	sessionOnce.Do(func() {
+		if current.logger, sessionErr = frameLogger(); sessionErr != nil {
+			return
+		}
+		if recordFile != "" {
+			f, err := os.Create(recordFile)
+			if err != nil {
+				sessionErr = err
+				return
+			}
+			current.record = cli.NewCaptureWriter(f)
+		}
+		if replayFile != "" {
+			capture, err := cli.LoadCapture(replayFile)
+			if err != nil {
+				sessionErr = err
+				return
+			}
+			current.replay = cli.NewReplayPort(capture)
+			current.replay.Realtime = replayRealtime
+		}
+	})
+	return &current, sessionErr
+}
+
+// frameLogger 根据 --trace、--trace-file、--pcap 创建 FrameLogger，都未指定时返回 nil
+func frameLogger() (cli.FrameLogger, error) {
+	var loggers cli.FrameLoggers
+	if trace {
+		loggers = append(loggers, cli.NewTextLogger(os.Stderr))
+	}
+	if traceFile != "" {
+		f, err := os.OpenFile(traceFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		loggers = append(loggers, cli.NewTextLogger(f))
+	}
+	if pcapFile != "" {
+		f, err := os.Create(pcapFile)
+		if err != nil {
+			return nil, err
+		}
+		loggers = append(loggers, pcap.NewWriter(f))
+	}
+	switch len(loggers) {
+	case 0:
+		return nil, nil
+	case 1:
+		return loggers[0], nil
+	}
+	return loggers, nil
+}
+
+// deviceUnitId 返回 --device 指定设备的站号，未指定设备时返回 0
+func deviceUnitId() (id uint8, err error) {
+	if deviceName == "" {
+		return
+	}
+	dev, err := cfg.Device(deviceName)
+	if err != nil {
+		return
+	}
+	if dev.UnitID == 0 {
+		err = fmt.Errorf("设备 %s 没有配置 unit_id", deviceName)
+		return
+	}
+	return dev.UnitID, nil
+}
+
+func init() {
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&cfgFile, "config", "", "配置文件 (默认 ./"+config.FileName+" 或 $HOME/."+config.FileName+")")
+	flags.StringVarP(&connectionName, "connection", "c", "", "使用配置文件中的连接")
+	flags.StringVarP(&deviceName, "device", "d", "", "使用配置文件中的设备")
+	flags.IntVar(&baudRate, "baud", 9600, "波特率")
+	flags.StringVar(&parity, "parity", "none", "校验位 none/odd/even/mark/space")
+	flags.IntVar(&dataBits, "data-bits", 8, "数据位")
+	flags.StringVar(&stopBits, "stop-bits", "1", "停止位 1/1.5/2")
+	flags.StringVar(&tcpAddress, "address", "", "Modbus TCP 服务器地址 host:port，指定后使用 TCP 连接")
+	flags.DurationVar(&turnaround, "turnaround", cli.DefaultTurnaroundDelay, "广播（站号 0）后等待从站处理的时间")
+	flags.BoolVar(&trace, "trace", false, "在标准错误输出收发的原始帧")
+	flags.StringVar(&traceFile, "trace-file", "", "把收发的原始帧追加到文件")
+	flags.StringVar(&pcapFile, "pcap", "", "把收发的帧保存为 Wireshark 可以打开的 pcap 文件")
+	flags.StringVar(&recordFile, "record", "", "把端口上的读写录制到文件，之后可以用 --replay 回放")
+	flags.StringVar(&replayFile, "replay", "", "不连接设备，回放 --record 录制的会话")
+	flags.BoolVar(&replayRealtime, "replay-realtime", false, "回放时按录制时的耗时等待")
+}
@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"go-oak/cli"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	diagSlave      uint8
+	diagLoopback   int
+	diagClear      bool
+	diagRestart    bool
+	diagClearLog   bool
+	diagListenOnly bool
+)
+
+// diagCounters 健康报告中的诊断计数器
+var diagCounters = []struct {
+	sub  uint16
+	name string
+}{
+	{cli.DiagBusMessageCount, "总线报文数"},
+	{cli.DiagBusCommunicationErrorCount, "CRC 错误数"},
+	{cli.DiagBusExceptionErrorCount, "异常响应数"},
+	{cli.DiagServerMessageCount, "本站报文数"},
+	{cli.DiagServerNoResponseCount, "未响应数"},
+	{cli.DiagServerNAKCount, "NAK 数"},
+	{cli.DiagServerBusyCount, "忙响应数"},
+	{cli.DiagBusCharacterOverrunCount, "字符溢出数"},
+}
+
+// diagCmd represents the diag command
+var diagCmd = &cobra.Command{
+	Use:   "diag",
+	Short: "读取站点的串行链路诊断计数器",
+	Long: `用诊断（功能码 08）和通信事件计数器、事件日志（功能码 11/12）检查一个站的
+通信质量：回环测试、总线报文数、CRC 错误数、异常响应数等，用于排查 RS-485 总线问题。
+从站不支持的项目显示为“不支持”。例如：
+
+  go-oak diag --slave 3
+  go-oak diag --device th01 --clear
+
+--restart 重启从站的通信（退出只听模式），--listen-only 让从站进入只听模式。`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var err error
+		if diagSlave == 0 {
+			if diagSlave, err = deviceUnitId(); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if diagSlave == 0 {
+			log.Fatal("请用 --slave 或 --device 指定站号")
+		}
+		opts, err := clientOptions(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		client, err := cli.NewClient(opts, diagSlave)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer client.Close()
+
+		switch {
+		case diagRestart:
+			var data uint16
+			if diagClearLog {
+				data = 0xFF00
+			}
+			_, err = client.Diagnostics(cli.DiagRestartCommunications, []byte{byte(data >> 8), byte(data)})
+			if cli.IsTimeout(err) {
+				log.Printf("站号 %d 没有响应（从站原来处于只听模式时不响应，属于正常情况）", diagSlave)
+				return
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("站号 %d 已重启通信", diagSlave)
+			return
+		case diagListenOnly:
+			if _, err = client.Diagnostics(cli.DiagForceListenOnlyMode, []byte{0, 0}); err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("站号 %d 已进入只听模式，用 --restart 恢复", diagSlave)
+			return
+		}
+
+		fmt.Printf("站号 %d @ %s\n", diagSlave, client.PortName())
+		printLoopback(client, diagLoopback)
+		if id, err := client.ReportServerId(); err != nil {
+			printDiag("从站 ID", diagError(err))
+		} else {
+			printDiag("从站 ID", id.String())
+		}
+		if status, err := client.ReadExceptionStatus(); err != nil {
+			printDiag("异常状态", diagError(err))
+		} else {
+			printDiag("异常状态", fmt.Sprintf("%08b", status))
+		}
+		if result, err := client.Diagnostics(cli.DiagReturnDiagnosticRegister, []byte{0, 0}); err != nil {
+			printDiag("诊断寄存器", diagError(err))
+		} else {
+			printDiag("诊断寄存器", fmt.Sprintf("% X", result))
+		}
+		var messages uint16
+		for _, c := range diagCounters {
+			count, err := cli.DiagnosticCounter(client, c.sub)
+			switch {
+			case err != nil:
+				printDiag(c.name, diagError(err))
+			case c.sub == cli.DiagBusMessageCount:
+				messages = count
+				printDiag(c.name, fmt.Sprint(count))
+			case c.sub == cli.DiagBusCommunicationErrorCount && messages > 0:
+				printDiag(c.name, fmt.Sprintf("%d (%.2f%%)", count, float64(count)*100/float64(messages)))
+			default:
+				printDiag(c.name, fmt.Sprint(count))
+			}
+		}
+		if status, count, err := client.GetCommEventCounter(); err != nil {
+			printDiag("通信事件数", diagError(err))
+		} else {
+			printDiag("通信事件数", fmt.Sprintf("%d (%s)", count, commStatus(status)))
+		}
+		if eventLog, err := client.GetCommEventLog(); err != nil {
+			printDiag("事件日志", diagError(err))
+		} else {
+			events := make([]string, len(eventLog.Events))
+			for i, e := range eventLog.Events {
+				events[i] = e.String()
+			}
+			printDiag("事件日志", fmt.Sprintf("%d 个事件，%d 条报文 (%s)：%s", eventLog.EventCount,
+				eventLog.MessageCount, commStatus(eventLog.Status), strings.Join(events, " ")))
+		}
+		if diagClear {
+			if _, err = client.Diagnostics(cli.DiagClearCounters, []byte{0, 0}); err != nil {
+				log.Fatal(err)
+			}
+			log.Println("计数器已清零")
+		}
+	},
+}
+
+// printLoopback 发送 n 次回环测试，打印成功次数和平均耗时
+func printLoopback(client cli.Client, n int) {
+	if n <= 0 {
+		return
+	}
+	var (
+		ok      int
+		elapsed time.Duration
+		lastErr error
+	)
+	for i := 0; i < n; i++ {
+		data := []byte{0xA5, byte(i)}
+		start := time.Now()
+		if _, err := client.Diagnostics(cli.DiagReturnQueryData, data); err != nil {
+			lastErr = err
+			continue
+		}
+		ok++
+		elapsed += time.Since(start)
+	}
+	report := fmt.Sprintf("%d/%d 成功", ok, n)
+	if ok > 0 {
+		report += fmt.Sprintf("，平均 %v", (elapsed / time.Duration(ok)).Round(time.Millisecond/10))
+	}
+	if lastErr != nil {
+		report += "，" + diagError(lastErr)
+	}
+	printDiag("回环测试", report)
+}
+
+// printDiag 打印一项诊断结果，名称按显示宽度对齐（汉字占两列）
+func printDiag(name, value string) {
+	width := 0
+	for _, r := range name {
+		if width++; r > unicode.MaxASCII {
+			width++
+		}
+	}
+	if width < 12 {
+		name += strings.Repeat(" ", 12-width)
+	}
+	fmt.Printf("  %s %s\n", name, value)
+}
+
+// diagError 把不支持的诊断项显示为“不支持”
+func diagError(err error) string {
+	var mbErr *cli.ModbusError
+	if errors.As(err, &mbErr) && mbErr.ExceptionCode == cli.ExceptionCodeIllegalFunction {
+		return "不支持"
+	}
+	return err.Error()
+}
+
+// commStatus 通信事件计数器和事件日志中的状态
+func commStatus(status uint16) string {
+	if status == cli.CommEventBusy {
+		return "忙"
+	}
+	return "空闲"
+}
+
+func init() {
+	rootCmd.AddCommand(diagCmd)
+	diagCmd.Flags().Uint8VarP(&diagSlave, "slave", "s", 0, "要诊断的站号")
+	diagCmd.Flags().IntVar(&diagLoopback, "loopback", 5, "回环测试的次数，0 表示不测试")
+	diagCmd.Flags().BoolVar(&diagClear, "clear", false, "读取后清零计数器")
+	diagCmd.Flags().BoolVar(&diagRestart, "restart", false, "重启从站的通信，退出只听模式")
+	diagCmd.Flags().BoolVar(&diagClearLog, "clear-log", false, "与 --restart 一起使用，同时清空事件日志")
+	diagCmd.Flags().BoolVar(&diagListenOnly, "listen-only", false, "让从站进入只听模式")
+}
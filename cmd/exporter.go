@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"go-oak/cli"
+	"go-oak/metrics"
+	"go-oak/poller"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exporterListen string
+	pollInterval   time.Duration
+)
+
+// exporterCmd represents the exporter command
+var exporterCmd = &cobra.Command{
+	Use:   "exporter",
+	Short: "轮询配置文件中的设备，以 Prometheus 格式导出",
+	Long: `按 --interval 轮询配置文件中所有设备的可读点位，在 --listen 上提供 /metrics：
+
+  modbus_tag_value{device,tag,unit}             点位的工程值
+  modbus_requests_total{port,unit_id,function}  请求数，另有 timeouts、crc_errors、exceptions
+  modbus_request_duration_seconds               响应延迟直方图
+
+例如：
+
+  go-oak exporter --config site.yaml --listen :9502 --interval 15s`,
+	Run: func(cmd *cobra.Command, args []string) {
+		m := metrics.New(prometheus.DefaultRegisterer)
+		p, err := newPoller(cmd, m)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer p.Close()
+		p.Handle(m.HandleReading)
+
+		http.Handle("/metrics", promhttp.Handler())
+		server := &http.Server{Addr: exporterListen}
+		go func() {
+			if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+		log.Printf("在 %s/metrics 导出 %d 台设备的数据", exporterListen, len(p.Database().Devices()))
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		_ = p.Run(ctx)
+		_ = server.Close()
+	},
+}
+
+// newPoller 按配置文件创建 Poller，logger 不为 nil 时附加到每个连接上记录收发的帧
+func newPoller(cmd *cobra.Command, logger cli.FrameLogger) (p *poller.Poller, err error) {
+	if p, err = newBus(cmd, logger); err != nil {
+		return
+	}
+	if len(p.Database().Devices()) == 0 {
+		err = errors.New("配置文件中没有设备")
+	}
+	return
+}
+
+// newBus 创建共享总线连接的 Poller，不要求配置文件中有设备
+func newBus(cmd *cobra.Command, logger cli.FrameLogger) (p *poller.Poller, err error) {
+	db, err := cfg.Database()
+	if err != nil {
+		return
+	}
+	p = poller.New(db, func(connection string) (cli.Client, error) {
+		opts, err := busOptions(cmd, connection)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case logger == nil:
+		case opts.FrameLogger == nil:
+			opts.FrameLogger = logger
+		default:
+			opts.FrameLogger = cli.FrameLoggers{logger, opts.FrameLogger}
+		}
+		return cli.NewClient(opts, 0)
+	})
+	p.Interval = pollInterval
+	p.DefaultConnection = cfg.ConnectionName("")
+	return
+}
+
+func init() {
+	rootCmd.AddCommand(exporterCmd)
+	exporterCmd.Flags().StringVar(&exporterListen, "listen", ":9502", "HTTP 监听地址")
+	exporterCmd.Flags().DurationVar(&pollInterval, "interval", poller.DefaultInterval, "轮询间隔")
+}
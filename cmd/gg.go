@@ -1,11 +1,36 @@
 package cmd
 
 import (
+	"fmt"
 	"github.com/spf13/cobra"
 	"go-oak/cli"
+	"go-oak/regmap"
 	"log"
 )
 
+var (
+	// ggRegister 保存站号的寄存器地址，写法见 regmap.ParseAddress
+	ggRegister string
+	// ggOneBased 非 Modicon 格式的地址从 1 开始
+	ggOneBased bool
+)
+
+// ggAddress 解析 --register 参数，返回保持寄存器的偏移
+func ggAddress() (offset uint16, err error) {
+	base := regmap.ZeroBased
+	if ggOneBased {
+		base = regmap.OneBased
+	}
+	area, offset, err := regmap.ParseAddress(ggRegister, base)
+	if err != nil {
+		return
+	}
+	if area != 0 && area != regmap.AreaHoldingRegister {
+		err = fmt.Errorf("站号寄存器 '%s' 不是保持寄存器", ggRegister)
+	}
+	return
+}
+
 // ggCmd represents the gg command
 var ggCmd = &cobra.Command{
 	Use:   "gg",
@@ -14,16 +39,29 @@ var ggCmd = &cobra.Command{
 如果发现可以响应信息的站，询问用户是否更改站号，
 输入 0，不更改站号，输入 1-20 中的数字将更改为指定站号。
 
-更改完成会提示插拔设备，用户插拔完成按回车，程序检验是否更改完成
-如果更改完成程序退出，否则程序报错。`,
+更改完成会提示插拔设备，程序检测到设备重新连接后检验是否更改完成
+如果更改完成程序退出，否则程序报错。
+
+站号默认保存在保持寄存器 40258（偏移 257），其他设备用 --register 指定，
+可以写成 40258、4x257、HR257 或 257；手册中的地址从 1 开始时加 --one-based，
+此时 4x258、HR258、258 都表示偏移 257（Modicon 格式 40258 总是从 1 开始）。`,
 	Run: func(cmd *cobra.Command, args []string) {
-		log.Println("更改站号...")
-		cli.ChangeSlaveId()
+		opts, err := clientOptions(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if opts.SlaveIdRegister, err = ggAddress(); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("更改站号（寄存器 %s）...", regmap.ModiconAddress(regmap.AreaHoldingRegister, opts.SlaveIdRegister))
+		cli.ChangeSlaveId(opts)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(ggCmd)
+	ggCmd.Flags().StringVar(&ggRegister, "register", "40258", "保存站号的保持寄存器地址，如 40258、4x257、HR257")
+	ggCmd.Flags().BoolVar(&ggOneBased, "one-based", false, "--register 中非 Modicon 格式的地址从 1 开始")
 
 	// Here you will define your flags and configuration settings.
 
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"go-oak/poller"
+	"go-oak/web"
+	"log"
+	"net/http"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	httpListen string
+	corsOrigin string
+)
+
+// httpCmd represents the http command
+var httpCmd = &cobra.Command{
+	Use:   "http",
+	Short: "提供读写设备的 HTTP/JSON 接口",
+	Long: `启动 HTTP 服务，按站号和地址或按配置文件中的点位读写设备，
+所有请求共用同一个总线连接并依次执行。例如：
+
+  curl 'localhost:8080/devices/6/input/1?count=2&type=int16&scale=0.1'
+  curl -X PUT -d '{"value": 25.5}' 'localhost:8080/devices/6/holding/257?scale=0.1'
+  curl localhost:8080/devices/th01/tags/temperature
+
+从站返回的异常码转换成 HTTP 状态码：非法功能 501，非法地址 404，非法数据值 422，
+设备忙 503，无响应 504，其他通信错误 502。
+
+配置文件中有设备时，按 --interval 轮询所有点位，在 / 提供实时显示的网页，
+并在 /ws 以 WebSocket 推送变化的值。客户端发送
+{"action": "subscribe", "device": "th01", "tag": "temperature"} 订阅，
+device 或 tag 为空表示全部，action 为 unsubscribe 时取消订阅。`,
+	Run: func(cmd *cobra.Command, args []string) {
+		p, err := newBus(cmd, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer p.Close()
+		s := web.NewServer(p)
+		s.CORSOrigin = corsOrigin
+		if len(p.Database().Devices()) > 0 {
+			hub := web.NewHub()
+			hub.CORSOrigin = corsOrigin
+			p.Handle(poller.OnChange(hub.HandleReading))
+			s.Handle("/ws", hub)
+			s.Handle("/", web.Dashboard())
+			go func() { _ = p.Run(context.Background()) }()
+		}
+		log.Printf("HTTP 服务监听 %s", httpListen)
+		if err = http.ListenAndServe(httpListen, s); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(httpCmd)
+	httpCmd.Flags().StringVar(&httpListen, "listen", ":8080", "HTTP 监听地址")
+	httpCmd.Flags().StringVar(&corsOrigin, "cors", "", "允许跨域访问的来源，如 * 或 http://localhost:3000")
+	httpCmd.Flags().DurationVar(&pollInterval, "interval", poller.DefaultInterval, "轮询间隔")
+}
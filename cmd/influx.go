@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"go-oak/poller"
+	"go-oak/sink"
+	"go-oak/util"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	influxURL         string
+	influxToken       string
+	influxFile        string
+	influxMeasurement string
+	influxBatch       int
+	influxFlush       time.Duration
+	bufferFile        string
+	bufferMax         int
+)
+
+// influxCmd represents the influx command
+var influxCmd = &cobra.Command{
+	Use:   "influx",
+	Short: "轮询配置文件中的设备，写入 InfluxDB",
+	Long: `按 --interval 轮询配置文件中所有设备的可读点位，按 line protocol 批量写入 InfluxDB
+（--url）或文件（--file，按天切换）。数据点带有 device、unit_id、tag、unit 标签。
+InfluxDB 不可用时数据点缓存到 --buffer 文件，恢复后补写。设置了 deadband、
+deadband_percent 或 heartbeat 的点位只在值变化超过死区或心跳到期时写入。例如：
+
+  go-oak influx --url 'http://localhost:8086/api/v2/write?org=lab&bucket=sensors' --token $TOKEN
+  go-oak influx --file /var/lib/go-oak/points.lp`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var s sink.Sink
+		switch {
+		case influxURL != "" && influxFile != "":
+			log.Fatal("--url 和 --file 只能指定一个")
+		case influxURL != "":
+			s = sink.NewInfluxHTTP(influxURL, influxToken)
+		case influxFile != "":
+			s = sink.NewLineWriter(util.NewDailyWriter(influxFile, nil))
+		default:
+			log.Fatal(errors.New("请用 --url 或 --file 指定写入目标"))
+		}
+		b := sink.NewBatcher(s)
+		b.Measurement = influxMeasurement
+		b.BatchSize = influxBatch
+		b.FlushInterval = influxFlush
+		if bufferFile != "" {
+			buffer, err := sink.NewDiskBuffer(bufferFile, bufferMax)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if n := buffer.Len(); n > 0 {
+				log.Printf("缓存中有 %d 个待补写的数据点", n)
+			}
+			b.Buffer = buffer
+		}
+		defer b.Close()
+
+		p, err := newPoller(cmd, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer p.Close()
+		p.Handle(poller.OnChange(b.HandleReading))
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.Run(ctx)
+		}()
+		_ = p.Run(ctx)
+		wg.Wait()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(influxCmd)
+	flags := influxCmd.Flags()
+	flags.StringVar(&influxURL, "url", "", "InfluxDB 写入地址，v2 为 .../api/v2/write?org=&bucket=，v1 为 .../write?db=")
+	flags.StringVar(&influxToken, "token", "", "InfluxDB API Token，也可以用环境变量 GO_OAK_TOKEN")
+	flags.StringVar(&influxFile, "file", "", "写入 line protocol 文件而不是 InfluxDB，按天切换")
+	flags.StringVar(&influxMeasurement, "measurement", sink.DefaultMeasurement, "measurement 名称")
+	flags.IntVar(&influxBatch, "batch", 500, "每批最多写入的数据点")
+	flags.DurationVar(&influxFlush, "flush", 10*time.Second, "最长多久写入一次")
+	flags.StringVar(&bufferFile, "buffer", "", "写入失败时缓存数据点的文件")
+	flags.IntVar(&bufferMax, "buffer-max", 1000000, "最多缓存的数据点，0 表示不限制")
+	flags.DurationVar(&pollInterval, "interval", poller.DefaultInterval, "轮询间隔")
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"context"
+	"go-oak/bridge"
+	"go-oak/poller"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+var mqttOptions bridge.Options
+
+// mqttCmd represents the mqtt command
+var mqttCmd = &cobra.Command{
+	Use:   "mqtt",
+	Short: "轮询配置文件中的设备，把点位的值发布到 MQTT",
+	Long: `按 --interval 轮询配置文件中所有设备的可读点位，以 JSON 发布到
+<prefix>/<设备>/<点位>。向 <prefix>/<设备>/<点位>/set 发布数字即可写入点位，
+写入结果发布到 .../result。设置了 deadband、deadband_percent 或 heartbeat
+的点位只在值变化超过死区或心跳到期时发布。例如：
+
+  go-oak mqtt --config site.yaml --broker tcp://localhost:1883 --qos 1 --retain
+  mosquitto_pub -t go-oak/th01/setpoint/set -m 25.5`,
+	Run: func(cmd *cobra.Command, args []string) {
+		p, err := newPoller(cmd, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer p.Close()
+		if mqttOptions.QoS > 2 {
+			log.Fatalf("QoS 只能是 0、1、2")
+		}
+		m := bridge.NewMQTT(p, mqttOptions)
+		p.Handle(poller.OnChange(m.HandleReading))
+		if err = m.Connect(); err != nil {
+			log.Fatal(err)
+		}
+		defer m.Close()
+		log.Printf("已连接 %s，发布 %d 台设备的数据", mqttOptions.Broker, len(p.Database().Devices()))
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		_ = p.Run(ctx)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mqttCmd)
+	flags := mqttCmd.Flags()
+	flags.StringVar(&mqttOptions.Broker, "broker", "tcp://localhost:1883", "MQTT 服务器地址")
+	flags.StringVar(&mqttOptions.ClientID, "client-id", "", "MQTT 客户端 ID，默认随机生成")
+	flags.StringVar(&mqttOptions.Username, "username", "", "MQTT 用户名")
+	flags.StringVar(&mqttOptions.Password, "password", "", "MQTT 密码，也可以用环境变量 GO_OAK_PASSWORD")
+	flags.StringVar(&mqttOptions.Prefix, "topic-prefix", bridge.DefaultPrefix, "主题前缀")
+	flags.Uint8Var(&mqttOptions.QoS, "qos", 0, "发布和订阅的 QoS (0/1/2)")
+	flags.BoolVar(&mqttOptions.Retain, "retain", false, "发布时设置 retain，保留最后一次的值")
+	flags.DurationVar(&pollInterval, "interval", poller.DefaultInterval, "轮询间隔")
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+	"go-oak/util"
+	"log"
+
+	"github.com/spf13/cobra"
+)
+
+// portsCmd represents the ports command
+var portsCmd = &cobra.Command{
+	Use:   "ports",
+	Short: "列出可用串口",
+	Long: `列出可用串口及其 USB VID、PID、序列号和产品名。
+
+其他命令可以用 --port 按这些信息选择串口，例如：
+  --port /dev/ttyUSB0
+  --port 1A86:7523
+  --port serial=A50285BI
+  --port vid=0403,product=FT232`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ports, err := util.FindPorts(portSelector)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%-16s %-6s %-6s %-20s %s\n", "NAME", "VID", "PID", "SERIAL", "PRODUCT")
+		for _, p := range ports {
+			fmt.Printf("%-16s %-6s %-6s %-20s %s\n", p.Name, p.VID, p.PID, p.SerialNumber, p.Product)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(portsCmd)
+}
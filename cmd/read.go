@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"go-oak/cli"
+	"go-oak/regmap"
+	"log"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+var writeBroadcast bool
+
+// readCmd represents the read command
+var readCmd = &cobra.Command{
+	Use:   "read [点位...]",
+	Short: "按点位名称读取设备数据",
+	Long: `按配置文件中设备的寄存器表，用点位名称读取数据并按倍率换算成工程值，
+不指定点位时读取设备的所有可读点位。例如：
+
+  go-oak read --device th01 temperature humidity`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dev, client, err := openDevice(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer client.Close()
+		tags, err := selectTags(dev, args)
+		if err != nil {
+			log.Fatal(err)
+		}
+		failed := false
+		for _, t := range tags {
+			if !t.Readable() {
+				continue
+			}
+			value, err := dev.ReadTag(client, t)
+			if err != nil {
+				log.Println(err)
+				failed = true
+				continue
+			}
+			fmt.Printf("%-20s %12s %s\n", t.Name, strconv.FormatFloat(value, 'g', -1, 64), t.Unit)
+		}
+		if failed {
+			log.Fatal("部分点位读取失败")
+		}
+	},
+}
+
+// writeCmd represents the write command
+var writeCmd = &cobra.Command{
+	Use:   "write 点位 值",
+	Short: "按点位名称写入设备数据",
+	Long: `按配置文件中设备的寄存器表，把工程值按倍率换算后写入点位。
+点位写成 点位.位 时只修改 16 位保持寄存器中的一位（0 为最低位），值非 0 置 1，
+其他位不变；从站不支持功能码 22 时先读再写。例如：
+
+  go-oak write --device th01 setpoint 25.5
+  go-oak write --device th01 control.3 1
+
+--broadcast 按设备的寄存器表向站号 0 广播，总线上所有从站都执行写入，
+从站不响应，写入后等待 --turnaround：
+
+  go-oak write --device th01 --broadcast setpoint 25.5`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		value, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			log.Fatalf("值 '%s' 不是数字", args[1])
+		}
+		dev, client, err := openDevice(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer client.Close()
+		if writeBroadcast {
+			if err = client.SetBroadcast(true); err != nil {
+				log.Fatal("广播只能用于串口（RTU）连接")
+			}
+		}
+		if name, bit, ok := dev.SplitBit(args[0]); ok {
+			err = dev.WriteBit(client, name, bit, value != 0)
+		} else {
+			err = dev.Write(client, args[0], value)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if writeBroadcast {
+			log.Printf("%s 广播 %v 完成", args[0], value)
+			return
+		}
+		log.Printf("%s.%s 写入 %v 成功", dev.Name, args[0], value)
+	},
+}
+
+// openDevice 按 --device 查找设备并连接其所在的总线
+func openDevice(cmd *cobra.Command) (dev *regmap.Device, client cli.Client, err error) {
+	if deviceName == "" {
+		err = errors.New("请用 --device 指定设备")
+		return
+	}
+	db, err := cfg.Database()
+	if err != nil {
+		return
+	}
+	if dev, err = db.Device(deviceName); err != nil {
+		return
+	}
+	opts, err := clientOptions(cmd)
+	if err != nil {
+		return
+	}
+	client, err = cli.NewClient(opts, dev.UnitID)
+	return
+}
+
+// selectTags 按名称选择点位，names 为空时返回所有点位
+func selectTags(dev *regmap.Device, names []string) (tags []*regmap.Tag, err error) {
+	if len(names) == 0 {
+		return dev.Map.Tags(), nil
+	}
+	for _, name := range names {
+		t, err := dev.Map.Tag(name)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return
+}
+
+func init() {
+	rootCmd.AddCommand(readCmd)
+	rootCmd.AddCommand(writeCmd)
+	writeCmd.Flags().BoolVar(&writeBroadcast, "broadcast", false, "向站号 0 广播，所有从站都执行写入")
+}
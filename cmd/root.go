@@ -6,6 +6,9 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// portSelector 全局 --port 参数，选择要使用的串口
+var portSelector string
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "go-oak",
@@ -19,6 +22,9 @@ to quickly create a Cobra application.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return loadConfig(cmd)
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -35,7 +41,8 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.go-oak.yaml)")
+	rootCmd.PersistentFlags().StringVarP(&portSelector, "port", "p", "",
+		"要使用的串口，可以是端口名、VID:PID，或 vid=,pid=,serial=,product= 组合（见 ports 命令）")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"go-oak/cli"
+	"log"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var scanLevel string
+
+// scanCmd represents the scan command
+var scanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "扫描站号并读取设备标识",
+	Long: `遍历可用端口上的站号，用读设备标识（功能码 43 / MEI 14）识别从站，
+列出厂商、产品代码和版本。不支持读设备标识的从站列出功能码 17 返回的从站 ID，
+也不支持时只列出站号。
+
+--level 指定读取的对象：basic 为厂商、产品代码和版本，regular 增加
+VendorUrl、ProductName 等，extended 还包括厂商自定义的对象。例如：
+
+  go-oak scan --port 1A86:7523 --level regular
+  go-oak scan --address 192.168.1.10:502`,
+	Run: func(cmd *cobra.Command, args []string) {
+		code, err := readDeviceIdCode(scanLevel)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts, err := clientOptions(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%-16s %-4s %-20s %-16s %-10s %s\n", "PORT", "ID", "VENDOR", "PRODUCT", "REVISION", "OTHER")
+		found := 0
+		err = cli.Scan(opts, code, func(r *cli.ScanResult) {
+			found++
+			id := r.Identification
+			if id == nil {
+				fmt.Printf("%-16s %-4d (不支持读设备标识)", r.Port, r.SlaveId)
+				if r.ServerId != nil {
+					fmt.Printf(" %s", r.ServerId)
+				}
+				fmt.Println()
+				return
+			}
+			var other []string
+			for _, obj := range id.IDs() {
+				if obj > cli.ObjectIdMajorMinorRevision {
+					other = append(other, fmt.Sprintf("%s=%q", cli.ObjectName(obj), id.Objects[obj]))
+				}
+			}
+			fmt.Printf("%-16s %-4d %-20s %-16s %-10s %s\n", r.Port, r.SlaveId,
+				id.VendorName(), id.ProductCode(), id.MajorMinorRevision(), strings.Join(other, " "))
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("扫描完成，找到 %d 个站", found)
+	},
+}
+
+// readDeviceIdCode 把 --level 转换成读设备标识的访问类型
+func readDeviceIdCode(level string) (byte, error) {
+	switch strings.ToLower(level) {
+	case "basic", "":
+		return cli.ReadDeviceIdBasic, nil
+	case "regular":
+		return cli.ReadDeviceIdRegular, nil
+	case "extended":
+		return cli.ReadDeviceIdExtended, nil
+	}
+	return 0, fmt.Errorf("不支持的 --level '%s'，可选 basic/regular/extended", level)
+}
+
+func init() {
+	rootCmd.AddCommand(scanCmd)
+	scanCmd.Flags().StringVar(&scanLevel, "level", "basic", "读取的设备标识对象 basic/regular/extended")
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"go-oak/cli"
+	"go-oak/util"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	sniffOutput string
+	sniffHex    bool
+)
+
+// sniffCmd represents the sniff command
+var sniffCmd = &cobra.Command{
+	Use:   "sniff",
+	Short: "被动监听 RS-485 总线",
+	Long: `只读方式打开串口，监听总线上已有的主站（PLC、HMI 等）与从站之间的通信，
+不发送任何数据。按静默时间和 CRC 校验切分 RTU 帧，把请求和响应配对后打印。
+
+使用 --output 把监听到的帧写入文件。`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opts, err := clientOptions(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if opts.IsTCP() {
+			log.Fatal(errors.New("sniff 只支持串口"))
+		}
+		info, err := util.SelectPort(opts.Port)
+		if err != nil {
+			log.Fatal(err)
+		}
+		port, err := util.OpenReconnect(info.Name, &opts.Mode)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer port.Close()
+
+		sniffer := cli.NewSniffer(port, info.Name, &opts.Mode)
+		var loggers cli.FrameLoggers
+		if opts.FrameLogger != nil {
+			loggers = append(loggers, opts.FrameLogger)
+		}
+		if sniffOutput != "" {
+			f, err := os.OpenFile(sniffOutput, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			loggers = append(loggers, cli.NewTextLogger(f))
+		}
+		if len(loggers) > 0 {
+			sniffer.FrameLogger = loggers
+		}
+		log.Printf("开始监听 %s，按 Ctrl+C 退出", info)
+		err = sniffer.Run(func(t *cli.Transaction) {
+			fmt.Println(t)
+			if sniffHex {
+				fmt.Printf("    TX % X\n", t.Request.Raw)
+				if t.Response != nil {
+					fmt.Printf("    RX % X\n", t.Response.Raw)
+				}
+			}
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sniffCmd)
+	sniffCmd.Flags().StringVarP(&sniffOutput, "output", "o", "", "把监听到的帧追加写入文件")
+	sniffCmd.Flags().BoolVarP(&sniffHex, "hex", "x", false, "同时打印十六进制原始帧")
+}
@@ -1,76 +1,243 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"go-oak/cli"
 	"go-oak/util"
+	"io"
 	"log"
+	"math"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
 )
 
-var slaveId uint8
+var (
+	slaveId    uint8
+	wsOutput   string
+	wsFile     string
+	wsInterval time.Duration
+	wsCount    int
+	// wsDeadband 温度和湿度的死区，两者之一超过死区或心跳到期时才输出记录
+	wsDeadband util.Deadband
+)
+
+// maxWsFailures 连续失败多少次后退出
+const maxWsFailures = 5
 
 // wsCmd represents the ws command
 var wsCmd = &cobra.Command{
 	Use:   "ws",
 	Short: "持续显示当前温湿度",
-	Long: `每隔 1 秒，客户端会向连接到的站请求温湿度信息，
+	Long: `每隔 --interval，客户端会向连接到的站请求温湿度信息，
 然后将请求到的信息转换成温湿度进行打印。
 
+用 --output csv 或 jsonl 输出带时间、端口和站号的记录，配合 --file 可以作为数据记录仪，
+文件按天切换，例如 --file th.csv 写入 th-2022-08-01.csv：
+
+  go-oak ws --output csv --file /var/log/th.csv --interval 1m
+
+用 --deadband 或 --deadband-percent 只在温度或湿度变化超过死区时输出，
+--heartbeat 指定值不变时最长多久输出一次：
+
+  go-oak ws --output jsonl --file th.jsonl --deadband 0.2 --heartbeat 10m
+
 可能会出现一些意想不到的状况。`,
 	Run: func(cmd *cobra.Command, args []string) {
+		out, err := newRecordWriter(wsOutput, wsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer out.Close()
+		opts, err := clientOptions(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if slaveId == 0 {
+			if slaveId, err = deviceUnitId(); err != nil {
+				log.Fatal(err)
+			}
+		}
 		var client cli.Client
-		var err error
 		if slaveId != 0 {
 			log.Println("SlaveId :", slaveId)
-			client, err = cli.NewClient(slaveId)
+			client, err = cli.NewClient(opts, slaveId)
 			if err != nil {
 				log.Fatalf("连接站号 %d 失败", slaveId)
 			}
 		} else {
-			client, err = cli.TempHumClient()
+			client, err = cli.TempHumClient(opts)
 			if err != nil {
 				log.Println("没有站可以响应温湿度")
 				return
 			}
 		}
 
-		SetupCloseHandler(client)
+		// Ctrl-C 时关闭客户端（打断正在等待的重连），结束采集后正常返回，
+		// 输出文件由 defer 关闭，记录不会丢失
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		var closeOnce sync.Once
+		closeClient := func() { closeOnce.Do(func() { _ = client.Close() }) }
+		defer closeClient()
+		go func() {
+			<-ctx.Done()
+			closeClient()
+		}()
 
-		//设置要接收的信号
-		for {
+		temperature, humidity := wsDeadband, wsDeadband
+		failures, samples := 0, 0
+		for ctx.Err() == nil && (wsCount == 0 || samples < wsCount) {
 			inputRegTemp, e3 := client.ReadInputRegisters(1, 2)
+			if ctx.Err() != nil {
+				break
+			}
 			if e3 == nil {
+				failures = 0
 				res := util.BytesToNFloat(inputRegTemp, 2)
-				fmt.Printf("\r目前温度：%.2f℃ 湿度：%.2f%%", res[0], res[1])
-				time.Sleep(time.Second)
+				r := &wsRecord{
+					Time:        time.Now(),
+					Port:        client.PortName(),
+					SlaveId:     client.SlaveId(),
+					Temperature: round2(res[0]),
+					Humidity:    round2(res[1]),
+				}
+				// 温度和湿度各自判断死区和心跳，两个都要判断，任一需要输出时输出整条记录
+				tChanged := temperature.Update(r.Temperature, r.Time)
+				hChanged := humidity.Update(r.Humidity, r.Time)
+				if !wsDeadband.Enabled() || tChanged || hChanged {
+					if err = out.Write(r); err != nil {
+						log.Println(err)
+						break
+					}
+				}
+				if samples++; wsCount == 0 || samples < wsCount {
+					sleepContext(ctx, wsInterval)
+				}
+			} else if errors.Is(e3, util.ErrPortLost) {
+				// 设备掉线，继续等待重新插入
+				log.Println(e3)
+			} else if failures++; failures < maxWsFailures {
+				// 重连后设备可能还没准备好，稍后重试
+				sleepContext(ctx, time.Second)
 			} else {
 				log.Println("无法获取温湿度信息")
+				for _, h := range client.Health() {
+					log.Printf("站号 %d: %v，连续失败 %d 次，最后错误: %v", h.SlaveId, h.State, h.ConsecutiveFailures, h.LastError)
+				}
 				break
 			}
 		}
+		if ctx.Err() != nil {
+			fmt.Println("\n进程终止，程序退出...")
+		}
 	},
 }
 
-func SetupCloseHandler(client cli.Client) {
-	c := make(chan os.Signal, 2)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-c
-		fmt.Println("\n进程终止，程序退出...")
-		if err := client.Close(); err != nil {
-			log.Fatal("客户端关闭失败")
+// wsRecord 一次温湿度记录
+type wsRecord struct {
+	Time        time.Time `json:"time"`
+	Port        string    `json:"port"`
+	SlaveId     byte      `json:"slave_id"`
+	Temperature float64   `json:"temperature"`
+	Humidity    float64   `json:"humidity"`
+}
+
+// csvHeader csv 格式的表头
+const csvHeader = "time,port,slave_id,temperature,humidity\n"
+
+// recordWriter 按 --output 的格式输出记录
+type recordWriter struct {
+	format string
+	w      io.Writer
+	// console 输出到终端时 table 格式在同一行刷新
+	console bool
+}
+
+// newRecordWriter 创建输出，file 为空时输出到标准输出
+func newRecordWriter(format, file string) (rw *recordWriter, err error) {
+	switch format {
+	case "table", "csv", "jsonl":
+	default:
+		return nil, fmt.Errorf("未知的输出格式 '%s'，可以是 table、csv、jsonl", format)
+	}
+	rw = &recordWriter{format: format, w: os.Stdout, console: file == ""}
+	var header []byte
+	if format == "csv" {
+		header = []byte(csvHeader)
+	}
+	if file != "" {
+		rw.w = util.NewDailyWriter(file, header)
+	} else if header != nil {
+		_, err = os.Stdout.Write(header)
+	}
+	return
+}
+
+func (rw *recordWriter) Write(r *wsRecord) (err error) {
+	var line string
+	switch rw.format {
+	case "csv":
+		line = fmt.Sprintf("%s,%s,%d,%.2f,%.2f\n",
+			r.Time.Format(time.RFC3339), r.Port, r.SlaveId, r.Temperature, r.Humidity)
+	case "jsonl":
+		data, _ := json.Marshal(r)
+		line = string(data) + "\n"
+	default:
+		line = fmt.Sprintf("%s %s 站号%02d 温度：%.2f℃ 湿度：%.2f%%",
+			r.Time.Format("2006-01-02 15:04:05"), r.Port, r.SlaveId, r.Temperature, r.Humidity)
+		if rw.console {
+			line = "\r" + line
+		} else {
+			line += "\n"
 		}
-		os.Exit(0)
-	}()
+	}
+	// 一条记录一次写入，按天切换文件时不会被拆开
+	_, err = io.WriteString(rw.w, line)
+	return
+}
+
+func (rw *recordWriter) Close() error {
+	if rw.console && rw.format == "table" {
+		// 结束同一行刷新的输出
+		fmt.Println()
+	}
+	if c, ok := rw.w.(io.Closer); ok && rw.w != os.Stdout {
+		return c.Close()
+	}
+	return nil
+}
+
+// round2 保留两位小数
+func round2(v float32) float64 {
+	return math.Round(float64(v)*100) / 100
+}
+
+// sleepContext 等待 d，ctx 结束时提前返回
+func sleepContext(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
 }
 
 func init() {
 	rootCmd.AddCommand(wsCmd)
 	wsCmd.Flags().Uint8VarP(&slaveId, "slave", "s", 0, "要连接的站号")
+	wsCmd.Flags().StringVarP(&wsOutput, "output", "o", "table", "输出格式 table/csv/jsonl")
+	wsCmd.Flags().StringVar(&wsFile, "file", "", "把记录写入文件，按天切换，文件名中插入日期")
+	wsCmd.Flags().DurationVar(&wsInterval, "interval", time.Second, "采集间隔")
+	wsCmd.Flags().IntVar(&wsCount, "count", 0, "采集多少次后退出，0 表示一直采集")
+	wsCmd.Flags().Float64Var(&wsDeadband.Absolute, "deadband", 0, "死区，温度或湿度变化超过它才输出")
+	wsCmd.Flags().Float64Var(&wsDeadband.Percent, "deadband-percent", 0, "百分比死区，温度或湿度变化超过该百分比才输出")
+	wsCmd.Flags().DurationVar(&wsDeadband.Heartbeat, "heartbeat", 0, "值不变时最长多久输出一次，0 表示不限制")
 }
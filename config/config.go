@@ -0,0 +1,332 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"go-oak/alarm"
+	"go-oak/cli"
+	"go-oak/regmap"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.bug.st/serial"
+	"gopkg.in/yaml.v3"
+)
+
+// FileName 默认配置文件名，依次在当前目录和用户主目录（以 . 开头）中查找
+const FileName = "go-oak.yaml"
+
+// Config 配置文件，定义命名的连接和设备，便于按现场保存配置
+//
+//	default: bus1
+//	connections:
+//	  bus1:
+//	    port: 1A86:7523
+//	    baud: 9600
+//	    parity: none
+//	    data_bits: 8
+//	    stop_bits: 1
+//	    scan: {from: 1, to: 20}
+//	  plc:
+//	    type: tcp
+//	    address: 192.168.1.10:502
+//	    timeout: 2s
+//	devices:
+//	  th01:
+//	    connection: bus1
+//	    unit_id: 6
+//	    one_based: false
+//	    registers:
+//	      - {name: temperature, area: input, address: 1, type: uint16, scale: 0.1, unit: ℃}
+//	      - {name: setpoint, address: "40258", type: int16, scale: 0.1}
+type Config struct {
+	// Default 未指定 --connection 时使用的连接
+	Default     string                 `yaml:"default"`
+	Connections map[string]*Connection `yaml:"connections"`
+	Devices     map[string]*Device     `yaml:"devices"`
+	// Alarms 报警规则，Notifiers 报警的通知方式
+	Alarms    []*alarm.Rule           `yaml:"alarms"`
+	Notifiers []*alarm.NotifierConfig `yaml:"notifiers"`
+
+	// dir 配置文件所在目录
+	dir string
+}
+
+// Connection 一条串口总线或 Modbus TCP 连接
+type Connection struct {
+	Name string `yaml:"-"`
+	// Type serial（默认）或 tcp
+	Type string `yaml:"type"`
+	// Port 串口选择器，格式见 util.PortInfo.Match
+	Port string `yaml:"port"`
+	// Address TCP 服务器地址 host:port
+	Address  string        `yaml:"address"`
+	BaudRate int           `yaml:"baud"`
+	DataBits int           `yaml:"data_bits"`
+	Parity   string        `yaml:"parity"`
+	StopBits string        `yaml:"stop_bits"`
+	Timeout  time.Duration `yaml:"timeout"`
+	Scan     Scan          `yaml:"scan"`
+	// TurnaroundDelay 广播后等待从站处理的时间
+	TurnaroundDelay time.Duration `yaml:"turnaround_delay"`
+}
+
+// Scan 扫描站号的范围
+type Scan struct {
+	From uint8 `yaml:"from"`
+	To   uint8 `yaml:"to"`
+}
+
+// Device 连接在某条总线上的设备
+type Device struct {
+	Name       string `yaml:"-"`
+	Connection string `yaml:"connection"`
+	// UnitID 站号，串口连接上必须配置（站号 0 为广播），TCP 连接上可以为 0
+	UnitID uint8 `yaml:"unit_id"`
+	// Map CSV 或 JSON 格式的寄存器表文件，相对路径相对于配置文件所在目录
+	Map string `yaml:"map"`
+	// Registers 直接写在配置文件中的点位，与 Map 中的点位合并
+	Registers []*regmap.Tag `yaml:"registers"`
+	// OneBased 设备手册中的地址从 1 开始，Map 和 Registers 中的地址减 1 后使用，
+	// Modicon 格式的地址（40001）不受影响
+	OneBased bool `yaml:"one_based"`
+}
+
+// AddressBase 返回设备地址的起始编号
+func (d *Device) AddressBase() regmap.AddressBase {
+	if d.OneBased {
+		return regmap.OneBased
+	}
+	return regmap.ZeroBased
+}
+
+// Load 读取配置文件
+func Load(path string) (cfg *Config, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	cfg = &Config{dir: filepath.Dir(path)}
+	if err = yaml.Unmarshal(data, cfg); err != nil {
+		err = fmt.Errorf("配置文件 %s: %w", path, err)
+		return
+	}
+	for name, c := range cfg.Connections {
+		c.Name = name
+	}
+	for name, d := range cfg.Devices {
+		d.Name = name
+		if d.Connection != "" && cfg.Connections[d.Connection] == nil {
+			err = fmt.Errorf("配置文件 %s: 设备 %s 的连接 %s 未定义", path, name, d.Connection)
+			return
+		}
+		// 串口上站号 0 是广播地址，没有配置 unit_id 时不能默认为 0
+		if d.UnitID == 0 && cfg.serial(d.Connection) {
+			err = fmt.Errorf("配置文件 %s: 设备 %s 在串口连接上，unit_id 必须在 1 到 247 之间", path, name)
+			return
+		}
+		for _, t := range d.Registers {
+			if err = t.ResolveAddress(d.AddressBase()); err != nil {
+				err = fmt.Errorf("配置文件 %s: 设备 %s: %w", path, name, err)
+				return
+			}
+		}
+	}
+	for _, r := range cfg.Alarms {
+		if err = r.Validate(); err != nil {
+			err = fmt.Errorf("配置文件 %s: %w", path, err)
+			return
+		}
+		if r.Device != "" && cfg.Devices[r.Device] == nil {
+			err = fmt.Errorf("配置文件 %s: 报警规则 %s 的设备 %s 未定义", path, r.Name, r.Device)
+			return
+		}
+	}
+	return
+}
+
+// serial 指定名称的连接是否为串口连接，名称为空时为默认连接。
+// 没有配置连接或无法确定默认连接时按默认的串口连接处理
+func (cfg *Config) serial(name string) bool {
+	c := cfg.Connections[cfg.ConnectionName(name)]
+	return c == nil || c.Serial()
+}
+
+// Find 返回默认配置文件路径，没有找到时返回空字符串
+func Find() string {
+	candidates := []string{FileName}
+	if home, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, filepath.Join(home, "."+FileName))
+	}
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// Connection 返回指定名称的连接，名称为空时返回默认连接。
+// 配置中没有任何连接且名称为空时返回空连接（使用默认参数）。
+func (cfg *Config) Connection(name string) (*Connection, error) {
+	if name = cfg.ConnectionName(name); name == "" {
+		if len(cfg.Connections) == 0 {
+			return &Connection{}, nil
+		}
+		return nil, fmt.Errorf("配置了多个连接，请用 --connection 指定: %s", strings.Join(cfg.ConnectionNames(), ", "))
+	}
+	c, ok := cfg.Connections[name]
+	if !ok {
+		return nil, fmt.Errorf("连接 %s 未定义", name)
+	}
+	return c, nil
+}
+
+// ConnectionName 返回连接的实际名称：名称为空时返回默认连接名，
+// 没有默认连接且只配置了一个连接时返回这个连接的名称，无法确定时返回空字符串
+func (cfg *Config) ConnectionName(name string) string {
+	if name != "" {
+		return name
+	}
+	if cfg.Default != "" {
+		return cfg.Default
+	}
+	if len(cfg.Connections) == 1 {
+		for n := range cfg.Connections {
+			return n
+		}
+	}
+	return ""
+}
+
+// ConnectionNames 返回按名称排序的连接名
+func (cfg *Config) ConnectionNames() []string {
+	names := make([]string, 0, len(cfg.Connections))
+	for name := range cfg.Connections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Device 返回指定名称的设备
+func (cfg *Config) Device(name string) (*Device, error) {
+	d, ok := cfg.Devices[name]
+	if !ok {
+		return nil, fmt.Errorf("设备 %s 未定义", name)
+	}
+	return d, nil
+}
+
+// Database 加载所有设备的寄存器表，生成标签数据库。
+// 没有指定连接的设备使用默认连接的名称，与显式指定默认连接的设备共用一条总线
+func (cfg *Config) Database() (db *regmap.Database, err error) {
+	db = regmap.NewDatabase()
+	for name, d := range cfg.Devices {
+		m, _ := regmap.NewMap()
+		if d.Map != "" {
+			path := d.Map
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(cfg.dir, path)
+			}
+			if m, err = regmap.LoadFileBase(path, d.AddressBase()); err != nil {
+				return nil, fmt.Errorf("设备 %s: %w", name, err)
+			}
+		}
+		if err = m.Add(d.Registers...); err != nil {
+			return nil, fmt.Errorf("设备 %s: %w", name, err)
+		}
+		db.Add(&regmap.Device{Name: name, Connection: cfg.ConnectionName(d.Connection), UnitID: d.UnitID, Map: m})
+	}
+	return
+}
+
+// Serial 是否为串口（RTU）连接
+func (c *Connection) Serial() bool {
+	switch strings.ToLower(c.Type) {
+	case "", "serial", "rtu":
+		return true
+	}
+	return false
+}
+
+// Options 把连接配置转换成 cli.Options，未配置的项使用默认值
+func (c *Connection) Options() (opts *cli.Options, err error) {
+	opts = cli.DefaultOptions()
+	switch strings.ToLower(c.Type) {
+	case "", "serial", "rtu":
+		opts.Port = c.Port
+	case "tcp":
+		if c.Address == "" {
+			return nil, fmt.Errorf("连接 %s: TCP 连接需要 address", c.Name)
+		}
+		opts.Address = c.Address
+	default:
+		return nil, fmt.Errorf("连接 %s: 未知的连接类型 '%s'", c.Name, c.Type)
+	}
+	if c.BaudRate != 0 {
+		opts.Mode.BaudRate = c.BaudRate
+	}
+	if c.DataBits != 0 {
+		opts.Mode.DataBits = c.DataBits
+	}
+	if c.Parity != "" {
+		if opts.Mode.Parity, err = ParseParity(c.Parity); err != nil {
+			return nil, err
+		}
+	}
+	if c.StopBits != "" {
+		if opts.Mode.StopBits, err = ParseStopBits(c.StopBits); err != nil {
+			return nil, err
+		}
+	}
+	if c.Timeout != 0 {
+		opts.Timeout = c.Timeout
+	}
+	if c.TurnaroundDelay != 0 {
+		opts.TurnaroundDelay = c.TurnaroundDelay
+	}
+	if c.Scan.From != 0 {
+		opts.ScanFrom = c.Scan.From
+	}
+	if c.Scan.To != 0 {
+		opts.ScanTo = c.Scan.To
+	}
+	if opts.ScanFrom > opts.ScanTo {
+		return nil, fmt.Errorf("连接 %s: 扫描范围 %d-%d 不合法", c.Name, opts.ScanFrom, opts.ScanTo)
+	}
+	return
+}
+
+// ParseParity 解析校验位：none/odd/even/mark/space 或 N/O/E/M/S
+func ParseParity(s string) (serial.Parity, error) {
+	switch strings.ToLower(s) {
+	case "n", "none":
+		return serial.NoParity, nil
+	case "o", "odd":
+		return serial.OddParity, nil
+	case "e", "even":
+		return serial.EvenParity, nil
+	case "m", "mark":
+		return serial.MarkParity, nil
+	case "s", "space":
+		return serial.SpaceParity, nil
+	}
+	return 0, errors.New("未知的校验位: " + s)
+}
+
+// ParseStopBits 解析停止位：1、1.5、2
+func ParseStopBits(s string) (serial.StopBits, error) {
+	switch s {
+	case "1":
+		return serial.OneStopBit, nil
+	case "1.5":
+		return serial.OnePointFiveStopBits, nil
+	case "2":
+		return serial.TwoStopBits, nil
+	}
+	return 0, errors.New("未知的停止位: " + s)
+}
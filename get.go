@@ -8,7 +8,7 @@ import (
 )
 
 func GetTemperAndHumidity() {
-	client, _ := cli.NewClient(6)
+	client, _ := cli.NewClient(cli.DefaultOptions(), 6)
 
 	inputRegTemp, e3 := client.ReadInputRegisters(1, 1)
 	if e3 == nil {
@@ -28,5 +28,5 @@ func GetTemperAndHumidity() {
 }
 
 func Auto() {
-	cli.ChangeSlaveId()
+	cli.ChangeSlaveId(cli.DefaultOptions())
 }
@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"errors"
+	"go-oak/cli"
+	"go-oak/poller"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "modbus"
+
+// Metrics 把轮询结果和总线通信统计导出为 Prometheus 指标。
+//
+// 点位的值由 HandleReading 更新（作为 poller.Handler 使用），
+// 请求、超时、CRC 错误、异常响应和延迟由 LogFrame 统计（作为 cli.FrameLogger 使用）。
+type Metrics struct {
+	value      *prometheus.GaugeVec
+	readErrors *prometheus.CounterVec
+	lastRead   *prometheus.GaugeVec
+
+	requests   *prometheus.CounterVec
+	timeouts   *prometheus.CounterVec
+	crcErrors  *prometheus.CounterVec
+	exceptions *prometheus.CounterVec
+	latency    *prometheus.HistogramVec
+
+	mu sync.Mutex
+	// pending 每个端口最近一次发出的请求，超时等没有响应内容时用它确定站号和功能码
+	pending map[string]cli.Summary
+}
+
+// New 创建指标并注册到 reg
+func New(reg prometheus.Registerer) *Metrics {
+	busLabels := []string{"port", "unit_id", "function"}
+	m := &Metrics{
+		value: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tag_value",
+			Help:      "点位最近一次读取的工程值",
+		}, []string{"device", "tag", "unit"}),
+		readErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tag_read_errors_total",
+			Help:      "点位读取失败的次数",
+		}, []string{"device", "tag"}),
+		lastRead: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tag_last_success_timestamp_seconds",
+			Help:      "点位最近一次读取成功的 Unix 时间",
+		}, []string{"device", "tag"}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_total",
+			Help:      "发出的请求数",
+		}, busLabels),
+		timeouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "timeouts_total",
+			Help:      "没有响应的请求数",
+		}, busLabels),
+		crcErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "crc_errors_total",
+			Help:      "CRC 校验错误的响应数",
+		}, busLabels),
+		exceptions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exceptions_total",
+			Help:      "异常响应数",
+		}, append(busLabels, "exception")),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "从发出请求到收到响应的时间",
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, busLabels),
+		pending: make(map[string]cli.Summary),
+	}
+	reg.MustRegister(m.value, m.readErrors, m.lastRead,
+		m.requests, m.timeouts, m.crcErrors, m.exceptions, m.latency)
+	return m
+}
+
+// HandleReading 实现 poller.Handler，更新点位的值
+func (m *Metrics) HandleReading(r *poller.Reading) {
+	if r.Err != nil {
+		m.readErrors.WithLabelValues(r.Device.Name, r.Tag.Name).Inc()
+		return
+	}
+	m.value.WithLabelValues(r.Device.Name, r.Tag.Name, r.Tag.Unit).Set(r.Value)
+	m.lastRead.WithLabelValues(r.Device.Name, r.Tag.Name).Set(float64(r.Time.Unix()))
+}
+
+// LogFrame 实现 cli.FrameLogger，统计请求和响应
+func (m *Metrics) LogFrame(f *cli.Frame) {
+	m.mu.Lock()
+	if f.Direction == cli.DirectionTX {
+		m.pending[f.Port] = f.Summary
+		m.mu.Unlock()
+		m.requests.With(busLabels(f.Port, f.Summary)).Inc()
+		return
+	}
+	request, ok := m.pending[f.Port]
+	delete(m.pending, f.Port)
+	m.mu.Unlock()
+	if !ok {
+		request = f.Summary
+	}
+	labels := busLabels(f.Port, request)
+	switch {
+	case cli.IsTimeout(f.Err):
+		m.timeouts.With(labels).Inc()
+	case errors.Is(f.Err, cli.ErrChecksum):
+		m.crcErrors.With(labels).Inc()
+	case f.Err == nil && f.Summary.Exception:
+		m.exceptions.WithLabelValues(labels["port"], labels["unit_id"], labels["function"],
+			strconv.Itoa(int(f.Summary.ExceptionCode))).Inc()
+	}
+	if f.Err == nil {
+		m.latency.With(labels).Observe(f.Latency.Seconds())
+	}
+}
+
+func busLabels(port string, s cli.Summary) prometheus.Labels {
+	function := cli.FunctionName(s.FunctionCode)
+	if function == "" {
+		function = strconv.Itoa(int(s.FunctionCode))
+	}
+	return prometheus.Labels{
+		"port":     port,
+		"unit_id":  strconv.Itoa(int(s.UnitId)),
+		"function": function,
+	}
+}
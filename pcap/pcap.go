@@ -0,0 +1,168 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"go-oak/cli"
+	"io"
+	"sync"
+	"time"
+)
+
+// 链路类型，见 https://www.tcpdump.org/linktypes.html
+const (
+	// LinkTypeUser0 用于 Modbus RTU 帧。Wireshark 中需在
+	// Preferences > Protocols > DLT_USER 里把 User 0 (DLT=147) 的 payload 协议设为 mbrtu
+	LinkTypeUser0 = 147
+	// LinkTypeRaw 原始 IPv4 包，用于 Modbus TCP，Wireshark 按 502 端口自动识别
+	LinkTypeRaw = 101
+)
+
+const (
+	magicMicroseconds = 0xa1b2c3d4
+	snapLen           = 65535
+	modbusTCPPort     = 502
+	clientTCPPort     = 49152
+)
+
+var (
+	clientIP = [4]byte{10, 0, 0, 1}
+	serverIP = [4]byte{10, 0, 0, 2}
+)
+
+// Writer 把 Modbus 帧写成 pcap 文件，实现 cli.FrameLogger，
+// 可以挂在客户端或 Sniffer 上记录整个会话。
+//
+// 文件的链路类型由第一帧的格式决定：RTU 帧使用 LinkTypeUser0，
+// TCP 帧加上合成的 IPv4/TCP 头后使用 LinkTypeRaw。
+// 之后格式不同的帧会被丢弃。
+type Writer struct {
+	mu       sync.Mutex
+	w        io.Writer
+	protocol string
+	// seq 合成 TCP 头的序号，[0] 客户端 -> 服务器，[1] 服务器 -> 客户端
+	seq [2]uint32
+	// Err 最近一次写入错误
+	Err error
+}
+
+// NewWriter 创建 pcap Writer，文件头在写入第一帧时输出
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, seq: [2]uint32{1, 1}}
+}
+
+// LogFrame 实现 cli.FrameLogger，没有原始数据的帧（如超时）不写入
+func (pw *Writer) LogFrame(f *cli.Frame) {
+	if len(f.Raw) == 0 {
+		return
+	}
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if pw.protocol == "" {
+		if pw.Err = pw.writeHeader(f.Protocol); pw.Err != nil {
+			return
+		}
+		pw.protocol = f.Protocol
+	}
+	if f.Protocol != pw.protocol {
+		pw.Err = fmt.Errorf("pcap: 帧格式 %s 与文件格式 %s 不一致", f.Protocol, pw.protocol)
+		return
+	}
+	data := f.Raw
+	if pw.protocol == cli.ProtocolTCP {
+		data = pw.tcpPacket(f.Direction, f.Raw)
+	}
+	pw.Err = pw.writePacket(f.Time, data)
+}
+
+func (pw *Writer) writeHeader(protocol string) error {
+	linkType := uint32(LinkTypeUser0)
+	if protocol == cli.ProtocolTCP {
+		linkType = LinkTypeRaw
+	}
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header, magicMicroseconds)
+	binary.LittleEndian.PutUint16(header[4:], 2) // 版本 2.4
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], snapLen)
+	binary.LittleEndian.PutUint32(header[20:], linkType)
+	_, err := pw.w.Write(header)
+	return err
+}
+
+func (pw *Writer) writePacket(t time.Time, data []byte) error {
+	header := make([]byte, 16)
+	binary.LittleEndian.PutUint32(header, uint32(t.Unix()))
+	binary.LittleEndian.PutUint32(header[4:], uint32(t.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(header[12:], uint32(len(data)))
+	if _, err := pw.w.Write(header); err != nil {
+		return err
+	}
+	_, err := pw.w.Write(data)
+	return err
+}
+
+// tcpPacket 给 Modbus TCP ADU 加上合成的 IPv4 和 TCP 头
+func (pw *Writer) tcpPacket(direction cli.Direction, payload []byte) []byte {
+	src, dst := clientIP, serverIP
+	srcPort, dstPort := uint16(clientTCPPort), uint16(modbusTCPPort)
+	out, in := 0, 1
+	if direction == cli.DirectionRX {
+		src, dst = dst, src
+		srcPort, dstPort = dstPort, srcPort
+		out, in = in, out
+	}
+	packet := make([]byte, 20+20+len(payload))
+
+	ip := packet[:20]
+	ip[0] = 0x45 // IPv4，头长 20 字节
+	binary.BigEndian.PutUint16(ip[2:], uint16(len(packet)))
+	ip[6] = 0x40 // 不分片
+	ip[8] = 64   // TTL
+	ip[9] = 6    // TCP
+	copy(ip[12:], src[:])
+	copy(ip[16:], dst[:])
+	binary.BigEndian.PutUint16(ip[10:], checksum(ip, 0))
+
+	tcp := packet[20:40]
+	binary.BigEndian.PutUint16(tcp, srcPort)
+	binary.BigEndian.PutUint16(tcp[2:], dstPort)
+	binary.BigEndian.PutUint32(tcp[4:], pw.seq[out])
+	binary.BigEndian.PutUint32(tcp[8:], pw.seq[in])
+	tcp[12] = 5 << 4 // 头长 20 字节
+	tcp[13] = 0x18   // PSH, ACK
+	binary.BigEndian.PutUint16(tcp[14:], 65535)
+	copy(packet[40:], payload)
+
+	// TCP 校验和包含伪首部
+	pseudo := make([]byte, 12)
+	copy(pseudo, src[:])
+	copy(pseudo[4:], dst[:])
+	pseudo[9] = 6
+	binary.BigEndian.PutUint16(pseudo[10:], uint16(20+len(payload)))
+	binary.BigEndian.PutUint16(tcp[16:], checksum(packet[20:], sum(pseudo)))
+
+	pw.seq[out] += uint32(len(payload))
+	return packet
+}
+
+// sum 按 16 位累加
+func sum(data []byte) (s uint32) {
+	for i := 0; i+1 < len(data); i += 2 {
+		s += uint32(data[i])<<8 | uint32(data[i+1])
+	}
+	if len(data)%2 == 1 {
+		s += uint32(data[len(data)-1]) << 8
+	}
+	return
+}
+
+// checksum 计算 IP/TCP 校验和，initial 为伪首部的累加和
+func checksum(data []byte, initial uint32) uint16 {
+	s := initial + sum(data)
+	for s>>16 != 0 {
+		s = s&0xffff + s>>16
+	}
+	return ^uint16(s)
+}
@@ -0,0 +1,58 @@
+package poller
+
+import (
+	"go-oak/util"
+	"sync"
+)
+
+// OnChange 返回按点位死区过滤的 Handler：值超过 Tag.Deadband 或 Tag.DeadbandPercent 变化、
+// 距上一次输出超过 Tag.Heartbeat，或读取由成功变为失败（及恢复）时才交给 next。
+//
+// 没有设置死区和心跳的点位每次都输出；只设置心跳时值有任何变化即输出。
+func OnChange(next Handler) Handler {
+	var mu sync.Mutex
+	states := make(map[[2]string]*changeState)
+	return func(r *Reading) {
+		t := r.Tag
+		if t.Deadband == 0 && t.DeadbandPercent == 0 && t.Heartbeat == 0 {
+			next(r)
+			return
+		}
+		key := [2]string{r.Device.Name, t.Name}
+		mu.Lock()
+		st, ok := states[key]
+		if !ok {
+			st = &changeState{deadband: util.Deadband{
+				Absolute:  t.Deadband,
+				Percent:   t.DeadbandPercent,
+				Heartbeat: t.Heartbeat,
+			}}
+			states[key] = st
+		}
+		emit := st.update(r)
+		mu.Unlock()
+		if emit {
+			next(r)
+		}
+	}
+}
+
+// changeState 一个点位的变化检测状态
+type changeState struct {
+	deadband util.Deadband
+	failed   bool
+}
+
+func (st *changeState) update(r *Reading) bool {
+	if r.Err != nil {
+		if st.failed {
+			return false
+		}
+		// 恢复后的第一个值一定输出
+		st.failed = true
+		st.deadband.Reset()
+		return true
+	}
+	st.failed = false
+	return st.deadband.Update(r.Value, r.Time)
+}
@@ -0,0 +1,247 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+	"go-oak/cli"
+	"go-oak/regmap"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultInterval 默认轮询间隔
+const DefaultInterval = 10 * time.Second
+
+// Reading 一个点位的一次采集结果
+type Reading struct {
+	Device *regmap.Device
+	Tag    *regmap.Tag
+	Value  float64
+	Time   time.Time
+	// Err 读取失败时的错误，此时 Value 无意义
+	Err error
+}
+
+// Handler 处理采集结果，同一连接上的结果按顺序交给 Handler，
+// 不同连接的结果可能并发到达
+type Handler func(r *Reading)
+
+// Opener 按连接名称打开客户端，名称为空表示默认连接
+type Opener func(connection string) (cli.Client, error)
+
+// Poller 按固定间隔轮询标签数据库中所有设备的可读点位。
+//
+// 每个连接（一条 RS-485 总线或一个 TCP 服务器）一个 goroutine，
+// 同一连接上的设备依次轮询。其他代码需要访问总线时通过 Do 获取连接，
+// 与轮询互斥，不会在总线上交错收发。
+type Poller struct {
+	// Interval 两轮采集的间隔
+	Interval time.Duration
+	// DefaultConnection 默认连接的名称。连接名为空时按这个名称使用总线，
+	// 避免同一个串口因为名称不同被打开两次
+	DefaultConnection string
+
+	db       *regmap.Database
+	open     Opener
+	handlers []Handler
+
+	mu    sync.Mutex
+	buses map[string]*bus
+}
+
+// bus 一个连接及其互斥锁
+type bus struct {
+	mu     sync.Mutex
+	client cli.Client
+}
+
+// New 创建 Poller，连接在第一次使用时打开
+func New(db *regmap.Database, open Opener) *Poller {
+	return &Poller{
+		Interval: DefaultInterval,
+		db:       db,
+		open:     open,
+		buses:    make(map[string]*bus),
+	}
+}
+
+// Handle 添加采集结果的处理函数，必须在 Run 之前调用
+func (p *Poller) Handle(h Handler) {
+	p.handlers = append(p.handlers, h)
+}
+
+// Database 返回轮询的标签数据库
+func (p *Poller) Database() *regmap.Database {
+	return p.db
+}
+
+// Run 开始轮询，直到 ctx 结束
+func (p *Poller) Run(ctx context.Context) error {
+	groups := p.connections()
+	if len(groups) == 0 {
+		return fmt.Errorf("poller: 没有需要轮询的设备")
+	}
+	var wg sync.WaitGroup
+	for _, devices := range groups {
+		wg.Add(1)
+		go func(devices []*regmap.Device) {
+			defer wg.Done()
+			p.loop(ctx, devices)
+		}(devices)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// PollOnce 立即把所有设备轮询一遍
+func (p *Poller) PollOnce() {
+	for _, devices := range p.connections() {
+		p.poll(devices)
+	}
+}
+
+// connections 按连接名称给设备分组
+func (p *Poller) connections() map[string][]*regmap.Device {
+	groups := make(map[string][]*regmap.Device)
+	for _, d := range p.db.Devices() {
+		name := p.ConnectionName(d.Connection)
+		groups[name] = append(groups[name], d)
+	}
+	for _, devices := range groups {
+		sort.Slice(devices, func(i, j int) bool { return devices[i].Name < devices[j].Name })
+	}
+	return groups
+}
+
+func (p *Poller) loop(ctx context.Context, devices []*regmap.Device) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	for {
+		p.poll(devices)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll 依次读取连接上所有设备的可读点位
+func (p *Poller) poll(devices []*regmap.Device) {
+	for _, d := range devices {
+		for _, t := range d.Map.Tags() {
+			if !t.Readable() {
+				continue
+			}
+			p.read(d, t)
+		}
+	}
+}
+
+// read 读取一个点位并把结果交给所有 Handler
+func (p *Poller) read(d *regmap.Device, t *regmap.Tag) *Reading {
+	r := &Reading{Device: d, Tag: t}
+	r.Err = p.Do(d.Connection, func(c cli.Client) (err error) {
+		r.Value, err = d.ReadTag(c, t)
+		return
+	})
+	r.Time = time.Now()
+	for _, h := range p.handlers {
+		h(r)
+	}
+	return r
+}
+
+// Do 独占连接执行 fn，连接未打开时先打开
+func (p *Poller) Do(connection string, fn func(c cli.Client) error) error {
+	connection = p.ConnectionName(connection)
+	b := p.bus(connection)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.client == nil {
+		c, err := p.open(connection)
+		if err != nil {
+			return err
+		}
+		b.client = c
+	}
+	return fn(b.client)
+}
+
+// Read 立即读取一个点位，结果同样交给所有 Handler
+func (p *Poller) Read(device, tag string) (r *Reading, err error) {
+	d, err := p.db.Device(device)
+	if err != nil {
+		return
+	}
+	t, err := d.Map.Tag(tag)
+	if err != nil {
+		return
+	}
+	r = p.read(d, t)
+	return r, r.Err
+}
+
+// Write 按点位名称向设备写入工程值。点位写成 点位.位 时只修改 16 位保持寄存器中的一位，
+// 值非 0 置 1，见 WriteBit
+func (p *Poller) Write(device, tag string, value float64) error {
+	d, err := p.db.Device(device)
+	if err != nil {
+		return err
+	}
+	if name, bit, ok := d.SplitBit(tag); ok {
+		return p.WriteBit(device, name, bit, value != 0)
+	}
+	return p.Do(d.Connection, func(c cli.Client) error {
+		return d.Write(c, tag, value)
+	})
+}
+
+// WriteBit 按点位名称修改 16 位保持寄存器中的一位。从站不支持功能码 22 时先读再写，
+// 读写期间持有总线，不会与轮询和其他写入交错
+func (p *Poller) WriteBit(device, tag string, bit uint, on bool) error {
+	d, err := p.db.Device(device)
+	if err != nil {
+		return err
+	}
+	return p.Do(d.Connection, func(c cli.Client) error {
+		return d.WriteBit(c, tag, bit, on)
+	})
+}
+
+// ConnectionName 返回连接的实际名称，空名称为默认连接
+func (p *Poller) ConnectionName(name string) string {
+	if name == "" {
+		return p.DefaultConnection
+	}
+	return name
+}
+
+func (p *Poller) bus(connection string) *bus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b, ok := p.buses[connection]
+	if !ok {
+		b = &bus{}
+		p.buses[connection] = b
+	}
+	return b
+}
+
+// Close 关闭所有已打开的连接
+func (p *Poller) Close() (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, b := range p.buses {
+		b.mu.Lock()
+		if b.client != nil {
+			if e := b.client.Close(); e != nil {
+				err = e
+			}
+			b.client = nil
+		}
+		b.mu.Unlock()
+	}
+	return
+}
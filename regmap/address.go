@@ -0,0 +1,147 @@
+package regmap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AddressBase 地址的起始编号。厂家手册中的地址有的从 0 开始，有的从 1 开始，
+// Modicon 格式（40001）总是从 1 开始，不受影响
+type AddressBase int
+
+const (
+	ZeroBased AddressBase = 0 // 地址即协议中的偏移
+	OneBased  AddressBase = 1 // 地址减 1 为协议中的偏移
+)
+
+// ParseAddress 解析各种写法的地址，返回数据区和从 0 开始的偏移：
+//
+//	40258、400258            Modicon 格式，首位 0/1/3/4 为数据区，其余为从 1 开始的编号
+//	4x0257、4x257            数据区前缀加地址，按 base 换算
+//	HR257、hr:257、holding 257 数据区名称或缩写（见 ParseArea）加地址，按 base 换算
+//	257                      只有地址，数据区为 0，按 base 换算
+//
+// 只有 5 位或 6 位、首位为 0/1/3/4 的纯数字才按 Modicon 格式解析。
+// 注意 0x 表示线圈，不是十六进制。
+func ParseAddress(s string, base AddressBase) (area Area, offset uint16, err error) {
+	s = strings.TrimSpace(s)
+	i := len(s)
+	for i > 0 && s[i-1] >= '0' && s[i-1] <= '9' {
+		i--
+	}
+	digits := s[i:]
+	prefix := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s[:i]), ":"))
+	if digits == "" {
+		return 0, 0, fmt.Errorf("地址 '%s' 不合法", s)
+	}
+	if prefix == "" {
+		if isModicon(digits) {
+			area, _ = ParseArea(digits[:1] + "x")
+			offset, err = parseOffset(digits[1:], OneBased)
+		} else {
+			offset, err = parseOffset(digits, base)
+		}
+	} else {
+		if area, err = ParseArea(prefix); err != nil {
+			return 0, 0, fmt.Errorf("地址 '%s' 的数据区不合法", s)
+		}
+		offset, err = parseOffset(digits, base)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("地址 '%s' %w", s, err)
+	}
+	return
+}
+
+// ModiconAddress 返回数据区和偏移对应的 Modicon 格式地址，
+// 偏移小于 9999 时为 5 位（40258），否则为 6 位（465536）
+func ModiconAddress(area Area, offset uint16) string {
+	var prefix int
+	switch area {
+	case AreaCoil:
+		prefix = 0
+	case AreaDiscreteInput:
+		prefix = 1
+	case AreaInputRegister:
+		prefix = 3
+	case AreaHoldingRegister:
+		prefix = 4
+	default:
+		return strconv.Itoa(int(offset))
+	}
+	if offset < 9999 {
+		return fmt.Sprintf("%d%04d", prefix, int(offset)+1)
+	}
+	return fmt.Sprintf("%d%05d", prefix, int(offset)+1)
+}
+
+// isModicon 纯数字地址是否为 Modicon 格式
+func isModicon(digits string) bool {
+	if len(digits) != 5 && len(digits) != 6 {
+		return false
+	}
+	switch digits[0] {
+	case '0', '1', '3', '4':
+		return true
+	}
+	return false
+}
+
+// isDecimal 是否为纯十进制数字
+func isDecimal(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseOffset 把十进制地址按 base 换算成从 0 开始的偏移
+func parseOffset(digits string, base AddressBase) (offset uint16, err error) {
+	n, err := strconv.ParseUint(digits, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("不合法")
+	}
+	if n < uint64(base) {
+		return 0, fmt.Errorf("从 %d 开始编号，不能为 %d", base, n)
+	}
+	n -= uint64(base)
+	if n > 0xFFFF {
+		return 0, fmt.Errorf("超出范围")
+	}
+	return uint16(n), nil
+}
+
+// resolveAddress 解析寄存器表中点位的地址，area 为表中单独指定的数据区，可以为 0。
+// 指定了数据区时纯数字地址不按 Modicon 格式解析，与原有的寄存器表保持一致；
+// 地址中带有数据区时必须与指定的数据区相同。指定了数据区时 0x 开头的地址
+// 可能是十六进制偏移也可能是线圈地址，不作猜测，返回错误。
+func resolveAddress(area Area, s string, base AddressBase) (Area, uint16, error) {
+	s = strings.TrimSpace(s)
+	if area != 0 && strings.HasPrefix(strings.ToLower(s), "0x") {
+		return 0, 0, fmt.Errorf("地址 '%s' 有歧义：0x 表示线圈，不是十六进制，指定了数据区时请写十进制偏移", s)
+	}
+	if area != 0 && isDecimal(s) {
+		offset, err := parseOffset(s, base)
+		if err != nil {
+			return 0, 0, fmt.Errorf("地址 '%s' %w", s, err)
+		}
+		return area, offset, nil
+	}
+	a, offset, err := ParseAddress(s, base)
+	if err != nil {
+		return 0, 0, err
+	}
+	if area != 0 && a != 0 && a != area {
+		return 0, 0, fmt.Errorf("地址 '%s' 的数据区 %v 与指定的数据区 %v 不一致", s, a, area)
+	}
+	if a == 0 {
+		a = area
+	}
+	return a, offset, nil
+}
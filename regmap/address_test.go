@@ -0,0 +1,161 @@
+package regmap
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		s      string
+		base   AddressBase
+		area   Area
+		offset uint16
+		err    bool
+	}{
+		{s: "40258", area: AreaHoldingRegister, offset: 257},
+		{s: "40258", base: OneBased, area: AreaHoldingRegister, offset: 257},
+		{s: "30001", area: AreaInputRegister, offset: 0},
+		{s: "00001", area: AreaCoil, offset: 0},
+		{s: "400001", area: AreaHoldingRegister, offset: 0},
+		{s: "465536", area: AreaHoldingRegister, offset: 65535},
+		{s: "10000", err: true},
+		{s: "400000", err: true},
+		{s: "465537", err: true},
+		{s: "4x0257", area: AreaHoldingRegister, offset: 257},
+		{s: "4x257", area: AreaHoldingRegister, offset: 257},
+		{s: "4x258", base: OneBased, area: AreaHoldingRegister, offset: 257},
+		{s: "4x0", base: OneBased, err: true},
+		{s: "HR257", area: AreaHoldingRegister, offset: 257},
+		{s: "hr:257", area: AreaHoldingRegister, offset: 257},
+		{s: "holding 257", area: AreaHoldingRegister, offset: 257},
+		{s: "ir 3", base: OneBased, area: AreaInputRegister, offset: 2},
+		// 0x 表示线圈，不是十六进制
+		{s: "0x10", area: AreaCoil, offset: 10},
+		{s: "0X10", area: AreaCoil, offset: 10},
+		{s: "0x1A", err: true},
+		{s: "257", offset: 257},
+		{s: "257", base: OneBased, offset: 256},
+		{s: "0", base: OneBased, err: true},
+		{s: "65536", err: true},
+		{s: "xx257", err: true},
+		{s: "HR", err: true},
+	}
+	for _, tt := range tests {
+		area, offset, err := ParseAddress(tt.s, tt.base)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseAddress(%q, %d) = %v %d，应该报错", tt.s, tt.base, area, offset)
+			}
+			continue
+		}
+		if err != nil || area != tt.area || offset != tt.offset {
+			t.Errorf("ParseAddress(%q, %d) = %v %d %v，预期 %v %d", tt.s, tt.base, area, offset, err, tt.area, tt.offset)
+		}
+	}
+}
+
+func TestResolveAddress(t *testing.T) {
+	tests := []struct {
+		area   Area
+		s      string
+		base   AddressBase
+		want   Area
+		offset uint16
+		err    bool
+	}{
+		// 指定了数据区时纯数字地址按偏移处理，不按 Modicon 格式解析
+		{area: AreaHoldingRegister, s: "40258", want: AreaHoldingRegister, offset: 40258},
+		{area: AreaHoldingRegister, s: "40258", base: OneBased, want: AreaHoldingRegister, offset: 40257},
+		{area: AreaHoldingRegister, s: "HR257", want: AreaHoldingRegister, offset: 257},
+		{area: AreaInputRegister, s: "HR257", err: true},
+		{s: "40258", want: AreaHoldingRegister, offset: 257},
+		// 指定了数据区时 0x 有歧义
+		{area: AreaCoil, s: "0x10", err: true},
+		{area: AreaHoldingRegister, s: "0X10", err: true},
+		{s: "0x10", want: AreaCoil, offset: 10},
+	}
+	for _, tt := range tests {
+		area, offset, err := resolveAddress(tt.area, tt.s, tt.base)
+		if tt.err {
+			if err == nil {
+				t.Errorf("resolveAddress(%v, %q, %d) = %v %d，应该报错", tt.area, tt.s, tt.base, area, offset)
+			}
+			continue
+		}
+		if err != nil || area != tt.want || offset != tt.offset {
+			t.Errorf("resolveAddress(%v, %q, %d) = %v %d %v，预期 %v %d", tt.area, tt.s, tt.base, area, offset, err, tt.want, tt.offset)
+		}
+	}
+}
+
+func TestModiconAddressRoundTrip(t *testing.T) {
+	for _, area := range []Area{AreaCoil, AreaDiscreteInput, AreaInputRegister, AreaHoldingRegister} {
+		for _, offset := range []uint16{0, 257, 9998, 9999, 65535} {
+			s := ModiconAddress(area, offset)
+			a, o, err := ParseAddress(s, OneBased)
+			if err != nil || a != area || o != offset {
+				t.Errorf("ModiconAddress(%v, %d) = %s，解析为 %v %d %v", area, offset, s, a, o, err)
+			}
+		}
+	}
+	if s := ModiconAddress(AreaHoldingRegister, 257); s != "40258" {
+		t.Errorf("ModiconAddress(holding, 257) = %s，预期 40258", s)
+	}
+	if s := ModiconAddress(AreaHoldingRegister, 9999); s != "410000" {
+		t.Errorf("ModiconAddress(holding, 9999) = %s，预期 410000", s)
+	}
+}
+
+func TestReadJSONStringAddress(t *testing.T) {
+	tags, err := ReadJSONBase(strings.NewReader(`[
+		{"name": "a", "area": "input", "address": 1},
+		{"name": "b", "address": "40258"},
+		{"name": "c", "address": "HR3"}]`), OneBased)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		area   Area
+		offset uint16
+	}{{AreaInputRegister, 0}, {AreaHoldingRegister, 257}, {AreaHoldingRegister, 2}}
+	for i, w := range want {
+		if tags[i].Area != w.area || tags[i].Address != w.offset {
+			t.Errorf("点位 %s: %v %d，预期 %v %d", tags[i].Name, tags[i].Area, tags[i].Address, w.area, w.offset)
+		}
+	}
+	if _, err = ReadJSONBase(strings.NewReader(`[{"name": "a", "area": "input", "address": 0}]`), OneBased); err == nil {
+		t.Error("从 1 开始编号时地址 0 应该报错")
+	}
+	if _, err = ReadJSON(strings.NewReader(`[{"name": "a", "area": "coil", "address": "0x10"}]`)); err == nil {
+		t.Error("指定了数据区时 0x 地址应该报错")
+	}
+}
+
+func TestTagYAMLStringAddress(t *testing.T) {
+	var tags []*Tag
+	err := yaml.Unmarshal([]byte(`
+- {name: a, area: input, address: 1, heartbeat: 1m}
+- {name: b, address: "40258", type: int16}
+- {name: c, address: HR3}`), &tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range tags {
+		if err = tag.ResolveAddress(OneBased); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tags[0].Area != AreaInputRegister || tags[0].Address != 0 || tags[0].Heartbeat != time.Minute {
+		t.Errorf("点位 a: %+v", tags[0])
+	}
+	if tags[1].Area != AreaHoldingRegister || tags[1].Address != 257 || tags[1].Type != TypeInt16 {
+		t.Errorf("点位 b: %+v", tags[1])
+	}
+	if tags[2].Area != AreaHoldingRegister || tags[2].Address != 2 {
+		t.Errorf("点位 c: %+v", tags[2])
+	}
+}
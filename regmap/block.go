@@ -0,0 +1,132 @@
+package regmap
+
+import (
+	"fmt"
+	"go-oak/cli"
+)
+
+// Block 同一数据区中从 Address 开始连续的 Count 个相同类型的值，
+// 用于不经过寄存器表直接按地址读写
+type Block struct {
+	Area    Area
+	Address uint16
+	Type    DataType
+	Count   uint16
+	// Scale 工程值 = 原始值 * Scale，为 0 时按 1 处理
+	Scale float64
+}
+
+// Validate 检查数据区和类型是否匹配，位数据区的类型统一为 bool
+func (b *Block) Validate() error {
+	if b.Count == 0 {
+		return fmt.Errorf("数量不能为 0")
+	}
+	t := b.tag(0)
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	b.Type = t.Type
+	return nil
+}
+
+// tag 返回第 i 个值对应的点位
+func (b *Block) tag(i int) *Tag {
+	return &Tag{
+		Name:    fmt.Sprintf("%v %d", b.Area, int(b.Address)+i*int(b.Type.Registers())),
+		Area:    b.Area,
+		Address: b.Address + uint16(i)*b.Type.Registers(),
+		Type:    b.Type,
+		Scale:   b.Scale,
+	}
+}
+
+// Read 读取所有值，调用前需已设置站号
+func (b *Block) Read(c cli.Client) (values []float64, err error) {
+	if err = b.Validate(); err != nil {
+		return
+	}
+	quantity := b.Count * b.Type.Registers()
+	var raw []byte
+	switch b.Area {
+	case AreaCoil:
+		raw, err = c.ReadCoils(b.Address, b.Count)
+	case AreaDiscreteInput:
+		raw, err = c.ReadDiscreteInputs(b.Address, b.Count)
+	case AreaInputRegister:
+		raw, err = c.ReadInputRegisters(b.Address, quantity)
+	case AreaHoldingRegister:
+		raw, err = c.ReadHoldingRegisters(b.Address, quantity)
+	}
+	if err != nil {
+		return
+	}
+	values = make([]float64, b.Count)
+	for i := range values {
+		if b.Area.IsBit() {
+			if i/8 >= len(raw) {
+				return nil, fmt.Errorf("响应数据长度 %d 不足", len(raw))
+			}
+			values[i] = float64(raw[i/8] >> (i % 8) & 1)
+			continue
+		}
+		size := int(b.Type.Registers()) * 2
+		if (i+1)*size > len(raw) {
+			return nil, fmt.Errorf("响应数据长度 %d 不足", len(raw))
+		}
+		if values[i], err = b.tag(i).Decode(raw[i*size:]); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// Write 写入 values，数量决定写入的个数，调用前需已设置站号
+func (b *Block) Write(c cli.Client, values []float64) (err error) {
+	b.Count = uint16(len(values))
+	if err = b.Validate(); err != nil {
+		return
+	}
+	if !b.Area.Writable() {
+		return fmt.Errorf("%v 区不可写", b.Area)
+	}
+	raw, err := b.Encode(values)
+	if err != nil {
+		return
+	}
+	switch {
+	case b.Area == AreaCoil && len(values) == 1:
+		var v uint16
+		if values[0] != 0 {
+			v = 0xFF00
+		}
+		_, err = c.WriteSingleCoil(b.Address, v)
+	case b.Area == AreaCoil:
+		_, err = c.WriteMultipleCoils(b.Address, b.Count, raw)
+	case len(raw) == 2:
+		_, err = c.WriteSingleRegister(b.Address, uint16(raw[0])<<8|uint16(raw[1]))
+	default:
+		_, err = c.WriteMultipleRegisters(b.Address, uint16(len(raw)/2), raw)
+	}
+	return
+}
+
+// Encode 把工程值转换成要写入的原始数据，位数据区按线圈的格式打包
+func (b *Block) Encode(values []float64) (raw []byte, err error) {
+	if b.Area.IsBit() {
+		raw = make([]byte, (len(values)+7)/8)
+		for i, v := range values {
+			if v != 0 {
+				raw[i/8] |= 1 << (i % 8)
+			}
+		}
+		return
+	}
+	for i, v := range values {
+		data, err := b.tag(i).Encode(v)
+		if err != nil {
+			return nil, err
+		}
+		raw = append(raw, data...)
+	}
+	return
+}
@@ -0,0 +1,119 @@
+package regmap
+
+import (
+	"fmt"
+	"go-oak/cli"
+	"strconv"
+	"strings"
+)
+
+// Device 标签数据库中的一台设备
+type Device struct {
+	Name       string
+	Connection string
+	UnitID     byte
+	Map        *Map
+}
+
+// Read 按点位名称读取工程值
+func (d *Device) Read(c cli.Client, name string) (value float64, err error) {
+	t, err := d.Map.Tag(name)
+	if err != nil {
+		return
+	}
+	return d.ReadTag(c, t)
+}
+
+// ReadTag 读取点位的工程值
+func (d *Device) ReadTag(c cli.Client, t *Tag) (value float64, err error) {
+	if !t.Readable() {
+		err = fmt.Errorf("点位 %s 不可读", t.Name)
+		return
+	}
+	c.SetSlaveId(d.UnitID)
+	var raw []byte
+	switch t.Area {
+	case AreaCoil:
+		raw, err = c.ReadCoils(t.Address, 1)
+	case AreaDiscreteInput:
+		raw, err = c.ReadDiscreteInputs(t.Address, 1)
+	case AreaInputRegister:
+		raw, err = c.ReadInputRegisters(t.Address, t.Type.Registers())
+	case AreaHoldingRegister:
+		raw, err = c.ReadHoldingRegisters(t.Address, t.Type.Registers())
+	}
+	if err != nil {
+		err = fmt.Errorf("%s.%s: %w", d.Name, t.Name, err)
+		return
+	}
+	return t.Decode(raw)
+}
+
+// Write 按点位名称写入工程值
+func (d *Device) Write(c cli.Client, name string, value float64) (err error) {
+	t, err := d.Map.Tag(name)
+	if err != nil {
+		return
+	}
+	return d.WriteTag(c, t, value)
+}
+
+// WriteTag 把工程值写入点位
+func (d *Device) WriteTag(c cli.Client, t *Tag, value float64) (err error) {
+	if !t.Writable() {
+		return fmt.Errorf("点位 %s 不可写", t.Name)
+	}
+	raw, err := t.Encode(value)
+	if err != nil {
+		return
+	}
+	c.SetSlaveId(d.UnitID)
+	switch {
+	case t.Area == AreaCoil:
+		var v uint16
+		if raw[0] != 0 {
+			v = 0xFF00
+		}
+		_, err = c.WriteSingleCoil(t.Address, v)
+	case t.Type.Registers() == 1:
+		_, err = c.WriteSingleRegister(t.Address, uint16(raw[0])<<8|uint16(raw[1]))
+	default:
+		_, err = c.WriteMultipleRegisters(t.Address, t.Type.Registers(), raw)
+	}
+	if err != nil {
+		err = fmt.Errorf("%s.%s: %w", d.Name, t.Name, err)
+	}
+	return
+}
+
+// SplitBit 把 点位.位 拆成点位名称和位（0 为最低位），name 本身是点位名称或不是这种写法时返回 false
+func (d *Device) SplitBit(name string) (tag string, bit uint, ok bool) {
+	if _, err := d.Map.Tag(name); err == nil {
+		return
+	}
+	i := strings.LastIndex(name, ".")
+	if i < 0 {
+		return
+	}
+	n, err := strconv.ParseUint(name[i+1:], 10, 4)
+	if err != nil {
+		return
+	}
+	return name[:i], uint(n), true
+}
+
+// WriteBit 把 16 位保持寄存器点位的第 bit 位置 1 或清 0，其他位不变
+func (d *Device) WriteBit(c cli.Client, name string, bit uint, on bool) (err error) {
+	t, err := d.Map.Tag(name)
+	if err != nil {
+		return
+	}
+	if !t.Writable() || t.Area != AreaHoldingRegister || t.Type.Registers() != 1 {
+		return fmt.Errorf("点位 %s 不是可写的 16 位保持寄存器", t.Name)
+	}
+	c.SetSlaveId(d.UnitID)
+	if err = cli.WriteBit(c, t.Address, bit, on); err != nil {
+		err = fmt.Errorf("%s.%s: %w", d.Name, t.Name, err)
+	}
+	return
+}
@@ -0,0 +1,249 @@
+package regmap
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Map 一种设备的寄存器表，按名称索引点位
+type Map struct {
+	tags   []*Tag
+	byName map[string]*Tag
+}
+
+// NewMap 创建寄存器表，点位名称不能重复
+func NewMap(tags ...*Tag) (*Map, error) {
+	m := &Map{byName: make(map[string]*Tag)}
+	if err := m.Add(tags...); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Add 添加点位
+func (m *Map) Add(tags ...*Tag) error {
+	for _, t := range tags {
+		if err := t.Validate(); err != nil {
+			return err
+		}
+		if _, ok := m.byName[t.Name]; ok {
+			return fmt.Errorf("点位 %s 重复定义", t.Name)
+		}
+		m.byName[t.Name] = t
+		m.tags = append(m.tags, t)
+	}
+	return nil
+}
+
+// Tag 按名称查找点位
+func (m *Map) Tag(name string) (*Tag, error) {
+	t, ok := m.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("点位 %s 未定义", name)
+	}
+	return t, nil
+}
+
+// Tags 按定义顺序返回所有点位
+func (m *Map) Tags() []*Tag {
+	return m.tags
+}
+
+// LoadFile 按扩展名读取 CSV 或 JSON 格式的寄存器表，地址从 0 开始
+func LoadFile(path string) (*Map, error) {
+	return LoadFileBase(path, ZeroBased)
+}
+
+// LoadFileBase 按扩展名读取 CSV 或 JSON 格式的寄存器表，
+// CSV 中非 Modicon 格式的地址和 JSON 中的地址按 base 换算
+func LoadFileBase(path string, base AddressBase) (*Map, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var tags []*Tag
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		tags, err = ReadCSVBase(f, base)
+	case ".json":
+		tags, err = ReadJSONBase(f, base)
+	default:
+		return nil, fmt.Errorf("不支持的寄存器表格式: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	m, err := NewMap(tags...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// ReadJSON 读取 JSON 数组格式的点位，地址从 0 开始，见 ReadJSONBase
+func ReadJSON(r io.Reader) (tags []*Tag, err error) {
+	return ReadJSONBase(r, ZeroBased)
+}
+
+// ReadJSONBase 读取 JSON 数组格式的点位，地址可以是数字或 ParseAddress 支持的字符串，
+// 数字地址和非 Modicon 格式的字符串地址按 base 换算成偏移
+//
+//	[{"name": "temperature", "area": "input", "address": 1, "type": "int16", "scale": 0.1, "unit": "℃"},
+//	 {"name": "setpoint", "address": "40258", "type": "int16", "scale": 0.1}]
+func ReadJSONBase(r io.Reader, base AddressBase) (tags []*Tag, err error) {
+	if err = json.NewDecoder(r).Decode(&tags); err != nil {
+		return
+	}
+	for _, t := range tags {
+		if err = t.ResolveAddress(base); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// csvColumns CSV 表头别名，厂家表格常用中文表头
+var csvColumns = map[string]string{
+	"name": "name", "tag": "name", "名称": "name", "点位": "name",
+	"area": "area", "区域": "area", "数据区": "area",
+	"address": "address", "addr": "address", "地址": "address",
+	"type": "type", "data type": "type", "datatype": "type", "类型": "type", "数据类型": "type",
+	"scale": "scale", "factor": "scale", "倍率": "scale", "系数": "scale",
+	"unit": "unit", "units": "unit", "单位": "unit",
+	"access": "access", "rw": "access", "读写": "access",
+	"description": "description", "desc": "description", "说明": "description", "描述": "description",
+	"deadband": "deadband", "死区": "deadband",
+	"deadband_percent": "deadband_percent", "deadband%": "deadband_percent", "死区%": "deadband_percent",
+	"heartbeat": "heartbeat", "心跳": "heartbeat",
+}
+
+// ReadCSV 读取 CSV 格式的点位，地址从 0 开始，见 ReadCSVBase
+func ReadCSV(r io.Reader) (tags []*Tag, err error) {
+	return ReadCSVBase(r, ZeroBased)
+}
+
+// ReadCSVBase 读取 CSV 格式的点位。第一行为表头，列的顺序任意，
+// 必须包含 name、address 列，其余列可选。地址的写法见 ParseAddress，
+// 地址中带有数据区（40258、HR257）时可以不填 area 列；
+// area 列指定了数据区时，纯数字地址按偏移处理，不按 Modicon 格式解析。
+// 非 Modicon 格式的地址按 base 换算成偏移。
+func ReadCSVBase(r io.Reader, base AddressBase) (tags []*Tag, err error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return
+	}
+	if len(records) == 0 {
+		return
+	}
+	columns := make(map[string]int)
+	for i, h := range records[0] {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		if name, ok := csvColumns[h]; ok {
+			columns[name] = i
+		}
+	}
+	for _, required := range []string{"name", "address"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV 缺少 %s 列", required)
+		}
+	}
+	for line, record := range records[1:] {
+		get := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		if get("name") == "" && get("address") == "" {
+			continue // 空行
+		}
+		t := &Tag{Name: get("name"), Unit: get("unit"), Description: get("description")}
+		if err = parseCSVTag(t, get, base); err != nil {
+			return nil, fmt.Errorf("第 %d 行: %w", line+2, err)
+		}
+		tags = append(tags, t)
+	}
+	return
+}
+
+func parseCSVTag(t *Tag, get func(string) string, base AddressBase) (err error) {
+	if s := get("area"); s != "" {
+		if t.Area, err = ParseArea(s); err != nil {
+			return
+		}
+	}
+	if t.Area, t.Address, err = resolveAddress(t.Area, get("address"), base); err != nil {
+		return
+	}
+	if t.Type, err = ParseDataType(get("type")); err != nil {
+		return
+	}
+	if s := get("scale"); s != "" {
+		if t.Scale, err = strconv.ParseFloat(s, 64); err != nil {
+			return fmt.Errorf("倍率 '%s' 不合法", s)
+		}
+	}
+	if s := get("deadband"); s != "" {
+		if t.Deadband, err = strconv.ParseFloat(s, 64); err != nil {
+			return fmt.Errorf("死区 '%s' 不合法", s)
+		}
+	}
+	if s := strings.TrimSuffix(get("deadband_percent"), "%"); s != "" {
+		if t.DeadbandPercent, err = strconv.ParseFloat(s, 64); err != nil {
+			return fmt.Errorf("百分比死区 '%s' 不合法", s)
+		}
+	}
+	if s := get("heartbeat"); s != "" {
+		if t.Heartbeat, err = time.ParseDuration(s); err != nil {
+			return fmt.Errorf("心跳 '%s' 不合法", s)
+		}
+	}
+	t.Access, err = ParseAccess(get("access"))
+	return
+}
+
+// Database 标签数据库，按设备名管理设备及其寄存器表
+type Database struct {
+	devices map[string]*Device
+}
+
+// NewDatabase 创建空的标签数据库
+func NewDatabase() *Database {
+	return &Database{devices: make(map[string]*Device)}
+}
+
+// Add 添加设备
+func (db *Database) Add(d *Device) {
+	db.devices[d.Name] = d
+}
+
+// Device 按名称查找设备
+func (db *Database) Device(name string) (*Device, error) {
+	d, ok := db.devices[name]
+	if !ok {
+		return nil, fmt.Errorf("设备 %s 未定义", name)
+	}
+	return d, nil
+}
+
+// Devices 返回按名称排序的所有设备
+func (db *Database) Devices() []*Device {
+	res := make([]*Device, 0, len(db.devices))
+	for _, d := range db.devices {
+		res = append(res, d)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
@@ -0,0 +1,377 @@
+package regmap
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Area Modbus 数据区
+type Area int
+
+const (
+	AreaCoil            Area = iota + 1 // 线圈，0x，可读写位
+	AreaDiscreteInput                   // 离散输入，1x，只读位
+	AreaInputRegister                   // 输入寄存器，3x，只读字
+	AreaHoldingRegister                 // 保持寄存器，4x，可读写字
+)
+
+// ParseArea 解析数据区名称，支持 coil/discrete/input/holding 及常见缩写
+func ParseArea(s string) (Area, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "coil", "coils", "co", "0x":
+		return AreaCoil, nil
+	case "discrete", "discrete_input", "di", "1x":
+		return AreaDiscreteInput, nil
+	case "input", "input_register", "ir", "3x":
+		return AreaInputRegister, nil
+	case "holding", "holding_register", "hr", "4x":
+		return AreaHoldingRegister, nil
+	}
+	return 0, fmt.Errorf("未知的数据区: '%s'", s)
+}
+
+func (a Area) String() string {
+	switch a {
+	case AreaCoil:
+		return "coil"
+	case AreaDiscreteInput:
+		return "discrete"
+	case AreaInputRegister:
+		return "input"
+	case AreaHoldingRegister:
+		return "holding"
+	}
+	return "unknown"
+}
+
+// IsBit 数据区是否按位访问
+func (a Area) IsBit() bool {
+	return a == AreaCoil || a == AreaDiscreteInput
+}
+
+// Writable 数据区是否可写
+func (a Area) Writable() bool {
+	return a == AreaCoil || a == AreaHoldingRegister
+}
+
+func (a Area) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Area) UnmarshalText(text []byte) (err error) {
+	*a, err = ParseArea(string(text))
+	return
+}
+
+// DataType 寄存器中的数据类型，32 位类型占两个寄存器，高字在前
+type DataType int
+
+const (
+	TypeUint16 DataType = iota
+	TypeInt16
+	TypeUint32
+	TypeInt32
+	TypeFloat32
+	TypeBool
+)
+
+// ParseDataType 解析数据类型名称
+func ParseDataType(s string) (DataType, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "uint16", "word", "u16":
+		return TypeUint16, nil
+	case "int16", "short", "i16":
+		return TypeInt16, nil
+	case "uint32", "dword", "u32":
+		return TypeUint32, nil
+	case "int32", "long", "i32":
+		return TypeInt32, nil
+	case "float32", "float", "real", "f32":
+		return TypeFloat32, nil
+	case "bool", "bit":
+		return TypeBool, nil
+	}
+	return 0, fmt.Errorf("未知的数据类型: '%s'", s)
+}
+
+func (t DataType) String() string {
+	switch t {
+	case TypeUint16:
+		return "uint16"
+	case TypeInt16:
+		return "int16"
+	case TypeUint32:
+		return "uint32"
+	case TypeInt32:
+		return "int32"
+	case TypeFloat32:
+		return "float32"
+	case TypeBool:
+		return "bool"
+	}
+	return "unknown"
+}
+
+// Registers 数据类型占用的寄存器数量
+func (t DataType) Registers() uint16 {
+	switch t {
+	case TypeUint32, TypeInt32, TypeFloat32:
+		return 2
+	}
+	return 1
+}
+
+func (t DataType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *DataType) UnmarshalText(text []byte) (err error) {
+	*t, err = ParseDataType(string(text))
+	return
+}
+
+// Access 读写权限
+type Access int
+
+const (
+	ReadOnly Access = iota
+	ReadWrite
+	WriteOnly
+)
+
+// ParseAccess 解析读写权限：r/ro、rw、w/wo
+func ParseAccess(s string) (Access, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "r", "ro", "read":
+		return ReadOnly, nil
+	case "rw", "wr", "read/write", "readwrite":
+		return ReadWrite, nil
+	case "w", "wo", "write":
+		return WriteOnly, nil
+	}
+	return 0, fmt.Errorf("未知的读写权限: '%s'", s)
+}
+
+func (a Access) String() string {
+	switch a {
+	case ReadOnly:
+		return "r"
+	case ReadWrite:
+		return "rw"
+	case WriteOnly:
+		return "w"
+	}
+	return "unknown"
+}
+
+func (a Access) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Access) UnmarshalText(text []byte) (err error) {
+	*a, err = ParseAccess(string(text))
+	return
+}
+
+// Tag 一个命名的寄存器（点位）
+type Tag struct {
+	Name    string   `json:"name" yaml:"name"`
+	Area    Area     `json:"area" yaml:"area"`
+	Address uint16   `json:"address" yaml:"address"`
+	Type    DataType `json:"type" yaml:"type"`
+	// Scale 工程值 = 原始值 * Scale，为 0 时按 1 处理
+	Scale       float64 `json:"scale,omitempty" yaml:"scale"`
+	Unit        string  `json:"unit,omitempty" yaml:"unit"`
+	Access      Access  `json:"access" yaml:"access"`
+	Description string  `json:"description,omitempty" yaml:"description"`
+	// Deadband、DeadbandPercent 绝对和百分比死区，工程值变化超过死区才输出
+	Deadband        float64 `json:"deadband,omitempty" yaml:"deadband"`
+	DeadbandPercent float64 `json:"deadband_percent,omitempty" yaml:"deadband_percent"`
+	// Heartbeat 值没有变化时最长多久重新输出一次
+	Heartbeat time.Duration `json:"heartbeat,omitempty" yaml:"heartbeat"`
+
+	// address JSON、YAML 中写成字符串的地址（"40258"、"HR257"），由 ResolveAddress 解析
+	address string
+}
+
+// UnmarshalJSON 地址可以是数字，也可以是 ParseAddress 支持的字符串
+func (t *Tag) UnmarshalJSON(data []byte) error {
+	type plain Tag
+	v := struct {
+		*plain
+		Address json.RawMessage `json:"address"`
+	}{plain: (*plain)(t)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if len(v.Address) > 0 && v.Address[0] == '"' {
+		return json.Unmarshal(v.Address, &t.address)
+	}
+	if len(v.Address) > 0 {
+		return json.Unmarshal(v.Address, &t.Address)
+	}
+	return nil
+}
+
+// UnmarshalYAML 地址可以是数字，也可以是 ParseAddress 支持的字符串
+func (t *Tag) UnmarshalYAML(value *yaml.Node) error {
+	type plain Tag
+	var address *yaml.Node
+	if value.Kind == yaml.MappingNode {
+		rest := *value
+		rest.Content = nil
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			if value.Content[i].Value == "address" {
+				address = value.Content[i+1]
+				continue
+			}
+			rest.Content = append(rest.Content, value.Content[i], value.Content[i+1])
+		}
+		value = &rest
+	}
+	if err := value.Decode((*plain)(t)); err != nil {
+		return err
+	}
+	if address == nil {
+		return nil
+	}
+	if address.Kind == yaml.ScalarNode && address.ShortTag() == "!!str" {
+		t.address = address.Value
+		return nil
+	}
+	return address.Decode(&t.Address)
+}
+
+// ResolveAddress 把读入的地址按 base 换算成从 0 开始的偏移。字符串地址的写法见
+// ParseAddress，其中的数据区必须与 Area 一致，Modicon 格式不受 base 影响
+func (t *Tag) ResolveAddress(base AddressBase) (err error) {
+	if t.address == "" {
+		if int(t.Address) < int(base) {
+			return fmt.Errorf("点位 %s 的地址从 %d 开始编号，不能为 %d", t.Name, base, t.Address)
+		}
+		t.Address -= uint16(base)
+		return
+	}
+	if t.Area, t.Address, err = resolveAddress(t.Area, t.address, base); err != nil {
+		return fmt.Errorf("点位 %s: %w", t.Name, err)
+	}
+	t.address = ""
+	return
+}
+
+// Validate 检查数据区、类型和读写权限是否匹配
+func (t *Tag) Validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("地址 %v 的点位没有名称", t.Address)
+	}
+	if t.address != "" {
+		return fmt.Errorf("点位 %s 的地址 '%s' 没有解析", t.Name, t.address)
+	}
+	if t.Area == 0 {
+		return fmt.Errorf("点位 %s 没有指定数据区", t.Name)
+	}
+	if t.Area.IsBit() && t.Type != TypeBool {
+		if t.Type != TypeUint16 {
+			return fmt.Errorf("点位 %s: %v 区只能是 bool 类型", t.Name, t.Area)
+		}
+		t.Type = TypeBool
+	}
+	if !t.Area.IsBit() && t.Type == TypeBool {
+		return fmt.Errorf("点位 %s: %v 区不支持 bool 类型", t.Name, t.Area)
+	}
+	if t.Access != ReadOnly && !t.Area.Writable() {
+		return fmt.Errorf("点位 %s: %v 区不可写", t.Name, t.Area)
+	}
+	if t.Deadband < 0 || t.DeadbandPercent < 0 || t.Heartbeat < 0 {
+		return fmt.Errorf("点位 %s: 死区和心跳不能为负", t.Name)
+	}
+	return nil
+}
+
+// Readable 点位是否可读
+func (t *Tag) Readable() bool {
+	return t.Access != WriteOnly
+}
+
+// Writable 点位是否可写
+func (t *Tag) Writable() bool {
+	return t.Access != ReadOnly && t.Area.Writable()
+}
+
+func (t *Tag) scale() float64 {
+	if t.Scale == 0 {
+		return 1
+	}
+	return t.Scale
+}
+
+// Decode 把读取到的原始数据（大端）转换成工程值
+func (t *Tag) Decode(raw []byte) (value float64, err error) {
+	if t.Type == TypeBool {
+		if len(raw) < 1 {
+			return 0, fmt.Errorf("点位 %s: 数据长度 %d 不足", t.Name, len(raw))
+		}
+		return float64(raw[0] & 1), nil
+	}
+	if need := int(t.Type.Registers()) * 2; len(raw) < need {
+		return 0, fmt.Errorf("点位 %s: 数据长度 %d 不足 %d", t.Name, len(raw), need)
+	}
+	switch t.Type {
+	case TypeUint16:
+		value = float64(binary.BigEndian.Uint16(raw))
+	case TypeInt16:
+		value = float64(int16(binary.BigEndian.Uint16(raw)))
+	case TypeUint32:
+		value = float64(binary.BigEndian.Uint32(raw))
+	case TypeInt32:
+		value = float64(int32(binary.BigEndian.Uint32(raw)))
+	case TypeFloat32:
+		value = float64(math.Float32frombits(binary.BigEndian.Uint32(raw)))
+	}
+	return value * t.scale(), nil
+}
+
+// Encode 把工程值转换成要写入寄存器的原始数据（大端）
+func (t *Tag) Encode(value float64) (raw []byte, err error) {
+	if t.Type == TypeBool {
+		if value != 0 {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	}
+	v := value / t.scale()
+	raw = make([]byte, t.Type.Registers()*2)
+	switch t.Type {
+	case TypeUint16:
+		err = checkRange(t, v, 0, math.MaxUint16)
+		binary.BigEndian.PutUint16(raw, uint16(math.Round(v)))
+	case TypeInt16:
+		err = checkRange(t, v, math.MinInt16, math.MaxInt16)
+		binary.BigEndian.PutUint16(raw, uint16(int16(math.Round(v))))
+	case TypeUint32:
+		err = checkRange(t, v, 0, math.MaxUint32)
+		binary.BigEndian.PutUint32(raw, uint32(math.Round(v)))
+	case TypeInt32:
+		err = checkRange(t, v, math.MinInt32, math.MaxInt32)
+		binary.BigEndian.PutUint32(raw, uint32(int32(math.Round(v))))
+	case TypeFloat32:
+		binary.BigEndian.PutUint32(raw, math.Float32bits(float32(v)))
+	}
+	if err != nil {
+		raw = nil
+	}
+	return
+}
+
+func checkRange(t *Tag, v, min, max float64) error {
+	if v = math.Round(v); v < min || v > max {
+		return fmt.Errorf("点位 %s: 值 %v 超出 %v 范围", t.Name, v*t.scale(), t.Type)
+	}
+	return nil
+}
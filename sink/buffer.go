@@ -0,0 +1,125 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// DiskBuffer 以 JSON 行的格式把数据点缓存到文件
+type DiskBuffer struct {
+	// Path 缓存文件路径
+	Path string
+	// MaxPoints 最多缓存多少个数据点，超过后丢弃新的数据点，0 表示不限制
+	MaxPoints int
+
+	mu    sync.Mutex
+	count int
+}
+
+// NewDiskBuffer 打开缓存文件，文件中已有的数据点会在下次写入时补写
+func NewDiskBuffer(path string, maxPoints int) (*DiskBuffer, error) {
+	b := &DiskBuffer{Path: path, MaxPoints: maxPoints}
+	points, err := b.Load()
+	if err != nil {
+		return nil, err
+	}
+	b.count = len(points)
+	return b, nil
+}
+
+// Len 返回缓存的数据点个数
+func (b *DiskBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.count
+}
+
+// Append 追加数据点
+func (b *DiskBuffer) Append(points []Point) (err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.MaxPoints > 0 && b.count+len(points) > b.MaxPoints {
+		dropped := b.count + len(points) - b.MaxPoints
+		if dropped > len(points) {
+			dropped = len(points)
+		}
+		points = points[:len(points)-dropped]
+		err = fmt.Errorf("缓存已满，丢弃 %d 个数据点", dropped)
+	}
+	if len(points) == 0 {
+		return
+	}
+	if e := writePoints(b.Path, os.O_APPEND, points); e != nil {
+		return e
+	}
+	b.count += len(points)
+	return
+}
+
+// writePoints 把数据点写入文件，flag 为 os.O_APPEND 或 os.O_TRUNC
+func writePoints(path string, flag int, points []Point) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|flag, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for i := range points {
+		if err = enc.Encode(&points[i]); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// Load 读取所有缓存的数据点，文件不存在时返回空
+func (b *DiskBuffer) Load() (points []Point, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	f, err := os.Open(b.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 4096), 1<<20)
+	for scanner.Scan() {
+		var p Point
+		if err = json.Unmarshal(scanner.Bytes(), &p); err != nil {
+			// 写到一半被中断的行，跳过
+			continue
+		}
+		points = append(points, p)
+	}
+	return points, scanner.Err()
+}
+
+// Replace 用 points 替换缓存的内容，points 为空时删除缓存文件
+func (b *DiskBuffer) Replace(points []Point) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(points) == 0 {
+		if err := os.Remove(b.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		b.count = 0
+		return nil
+	}
+	// 先写临时文件再改名，中途出错不会丢失缓存
+	tmp := b.Path + ".tmp"
+	if err := writePoints(tmp, os.O_TRUNC, points); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, b.Path); err != nil {
+		return err
+	}
+	b.count = len(points)
+	return nil
+}
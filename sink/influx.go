@@ -0,0 +1,142 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// AppendLine 把数据点按 InfluxDB line protocol 追加到 buf，时间精度为纳秒：
+//
+//	modbus,device=th01,tag=temperature,unit_id=6 value=23.5 1659312000000000000
+//
+// line protocol 不能表示 NaN 和 ±Inf，这样的字段被跳过，
+// 没有有效字段的数据点不输出，否则整批写入都会被拒绝。
+func AppendLine(buf []byte, p *Point) []byte {
+	fields := make([]string, 0, len(p.Fields))
+	for k, v := range p.Fields {
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			fields = append(fields, k)
+		}
+	}
+	if len(fields) == 0 {
+		return buf
+	}
+	sort.Strings(fields)
+	buf = append(buf, measurementEscaper.Replace(p.Measurement)...)
+	keys := make([]string, 0, len(p.Tags))
+	for k, v := range p.Tags {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	// 按标签名排序，InfluxDB 写入时效率更高
+	sort.Strings(keys)
+	for _, k := range keys {
+		buf = append(buf, ',')
+		buf = append(buf, tagEscaper.Replace(k)...)
+		buf = append(buf, '=')
+		buf = append(buf, tagEscaper.Replace(p.Tags[k])...)
+	}
+	for i, k := range fields {
+		if i == 0 {
+			buf = append(buf, ' ')
+		} else {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, tagEscaper.Replace(k)...)
+		buf = append(buf, '=')
+		buf = strconv.AppendFloat(buf, p.Fields[k], 'g', -1, 64)
+	}
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, p.Time.UnixNano(), 10)
+	return append(buf, '\n')
+}
+
+// encode 把一批数据点编码成 line protocol
+func encode(points []Point) []byte {
+	var buf []byte
+	for i := range points {
+		buf = AppendLine(buf, &points[i])
+	}
+	return buf
+}
+
+// InfluxHTTP 通过 HTTP 写入 InfluxDB。URL 为完整的写入地址，例如
+// v2 的 http://localhost:8086/api/v2/write?org=my-org&bucket=sensors
+// 或 v1 的 http://localhost:8086/write?db=sensors
+type InfluxHTTP struct {
+	URL string
+	// Token v2 的 API Token，v1 可以用 "用户名:密码"
+	Token  string
+	Client *http.Client
+}
+
+// NewInfluxHTTP 创建 InfluxDB HTTP 写入
+func NewInfluxHTTP(url, token string) *InfluxHTTP {
+	return &InfluxHTTP{URL: url, Token: token, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *InfluxHTTP) Write(points []Point) error {
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(encode(points)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.Token)
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		err = fmt.Errorf("influxdb: %s: %s", resp.Status, bytes.TrimSpace(body))
+		// 4xx 表示数据或认证有问题，重试也不会成功；408 和 429 除外
+		if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusRequestTimeout &&
+			resp.StatusCode != http.StatusTooManyRequests {
+			err = &PermanentError{Err: err}
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *InfluxHTTP) Close() error {
+	return nil
+}
+
+// LineWriter 把数据点按 line protocol 写入 w，例如文件，之后可以用 influx write 导入
+type LineWriter struct {
+	w io.Writer
+}
+
+// NewLineWriter 创建写入 w 的 Sink，w 实现 io.Closer 时 Close 会关闭它
+func NewLineWriter(w io.Writer) *LineWriter {
+	return &LineWriter{w: w}
+}
+
+func (s *LineWriter) Write(points []Point) error {
+	_, err := s.w.Write(encode(points))
+	return err
+}
+
+func (s *LineWriter) Close() error {
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package sink
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func point(tag string, value float64) Point {
+	return Point{
+		Measurement: DefaultMeasurement,
+		Tags:        map[string]string{"device": "th01", "tag": tag, "unit_id": "6"},
+		Fields:      map[string]float64{"value": value},
+		Time:        time.Unix(1659312000, 0),
+	}
+}
+
+func TestAppendLine(t *testing.T) {
+	p := Point{
+		Measurement: "modbus data",
+		Tags:        map[string]string{"tag": "a=b", "device": "th 01", "unit": ""},
+		Fields:      map[string]float64{"value": 23.5, "raw": 235},
+		Time:        time.Unix(0, 1659312000000000000),
+	}
+	want := `modbus\ data,device=th\ 01,tag=a\=b raw=235,value=23.5 1659312000000000000` + "\n"
+	if got := string(AppendLine(nil, &p)); got != want {
+		t.Fatalf("AppendLine = %q，预期 %q", got, want)
+	}
+
+	// NaN 和 Inf 字段跳过，没有有效字段时整个数据点跳过
+	p.Fields = map[string]float64{"value": math.NaN(), "raw": 235}
+	if got := string(AppendLine(nil, &p)); !strings.Contains(got, " raw=235 ") || strings.Contains(got, "value") {
+		t.Fatalf("NaN 字段没有跳过: %q", got)
+	}
+	p.Fields = map[string]float64{"value": math.Inf(1)}
+	if got := AppendLine([]byte("x"), &p); string(got) != "x" {
+		t.Fatalf("没有有效字段的数据点应该跳过，得到 %q", got)
+	}
+}
+
+// influxServer 记录收到的写入请求，down 为 true 时返回 503，
+// 请求体包含 reject 时返回 400
+type influxServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	down   bool
+	reject string
+	bodies []string
+	auth   string
+}
+
+func newInfluxServer(t *testing.T) *influxServer {
+	s := &influxServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.down {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if s.reject != "" && strings.Contains(string(body), s.reject) {
+			http.Error(w, "field type conflict", http.StatusBadRequest)
+			return
+		}
+		s.auth = r.Header.Get("Authorization")
+		s.bodies = append(s.bodies, string(body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *influxServer) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+// lines 返回每个请求中的行数
+func (s *influxServer) lines() (res []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.bodies {
+		res = append(res, strings.Count(b, "\n"))
+	}
+	return
+}
+
+func TestBatcherBatches(t *testing.T) {
+	srv := newInfluxServer(t)
+	b := NewBatcher(NewInfluxHTTP(srv.URL+"/api/v2/write?org=o&bucket=b", "secret"))
+	b.BatchSize = 2
+	for i := 0; i < 5; i++ {
+		b.Add(point("t", float64(i)))
+	}
+	b.Add(point("bad", math.NaN()))
+	if err := b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.lines(); len(got) != 3 || got[0] != 2 || got[1] != 2 || got[2] != 1 {
+		t.Fatalf("每批的行数 %v，预期 [2 2 1]（NaN 数据点跳过）", got)
+	}
+	if srv.auth != "Token secret" {
+		t.Fatalf("Authorization = %q", srv.auth)
+	}
+}
+
+func TestBatcherReplaysAfterOutage(t *testing.T) {
+	srv := newInfluxServer(t)
+	path := filepath.Join(t.TempDir(), "buffer.jsonl")
+	buffer, err := NewDiskBuffer(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBatcher(NewInfluxHTTP(srv.URL+"/write?db=sensors", ""))
+	b.Buffer = buffer
+
+	// 服务不可用时写入磁盘缓存
+	srv.setDown(true)
+	b.Add(point("a", 1))
+	b.Add(point("b", 2))
+	if err = b.Flush(); err == nil {
+		t.Fatal("服务不可用时 Flush 应该返回错误")
+	}
+	b.Add(point("c", 3))
+	if err = b.Flush(); err == nil {
+		t.Fatal("服务不可用时 Flush 应该返回错误")
+	}
+	if n := buffer.Len(); n != 3 {
+		t.Fatalf("缓存了 %d 个数据点，预期 3", n)
+	}
+
+	// 重启后缓存仍在
+	if buffer, err = NewDiskBuffer(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n := buffer.Len(); n != 3 {
+		t.Fatalf("重新打开后缓存了 %d 个数据点，预期 3", n)
+	}
+	b.Buffer = buffer
+
+	// 恢复后先补写缓存，再写新的数据点
+	srv.setDown(false)
+	b.Add(point("d", 4))
+	if err = b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	srv.mu.Lock()
+	bodies := strings.Join(srv.bodies, "")
+	srv.mu.Unlock()
+	var order []string
+	for _, line := range strings.Split(strings.TrimSpace(bodies), "\n") {
+		for _, tag := range []string{"a", "b", "c", "d"} {
+			if strings.Contains(line, ",tag="+tag+",") {
+				order = append(order, tag)
+			}
+		}
+	}
+	if strings.Join(order, "") != "abcd" {
+		t.Fatalf("写入顺序 %v，预期 a b c d", order)
+	}
+	if buffer.Len() != 0 {
+		t.Fatalf("补写后缓存应为空，还有 %d 个", buffer.Len())
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("补写后缓存文件应该删除: %v", err)
+	}
+}
+
+func TestBatcherDropsRejectedBatch(t *testing.T) {
+	srv := newInfluxServer(t)
+	buffer, err := NewDiskBuffer(filepath.Join(t.TempDir(), "buffer.jsonl"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBatcher(NewInfluxHTTP(srv.URL+"/write?db=sensors", ""))
+	b.Buffer = buffer
+	b.BatchSize = 1
+
+	// 服务不可用时缓存，之后被拒绝的一批不能一直卡在缓存里
+	srv.setDown(true)
+	b.Add(point("bad", 1))
+	b.Add(point("a", 2))
+	if err = b.Flush(); err == nil {
+		t.Fatal("服务不可用时 Flush 应该返回错误")
+	}
+	srv.setDown(false)
+	srv.mu.Lock()
+	srv.reject = ",tag=bad,"
+	srv.mu.Unlock()
+	b.Add(point("bad", 3))
+	b.Add(point("b", 4))
+	if err = b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if buffer.Len() != 0 {
+		t.Fatalf("被拒绝的数据点应该丢弃，缓存中还有 %d 个", buffer.Len())
+	}
+	srv.mu.Lock()
+	bodies := strings.Join(srv.bodies, "")
+	srv.mu.Unlock()
+	if !strings.Contains(bodies, ",tag=a,") || !strings.Contains(bodies, ",tag=b,") || strings.Contains(bodies, ",tag=bad,") {
+		t.Fatalf("写入的数据 %q", bodies)
+	}
+
+	// 其他 4xx 是永久性错误，408、429 和 5xx 仍然重试
+	for status, permanent := range map[int]bool{400: true, 401: true, 408: false, 429: false, 503: false} {
+		code := status
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}))
+		err := NewInfluxHTTP(s.URL, "").Write([]Point{point("t", 1)})
+		s.Close()
+		var p *PermanentError
+		if errors.As(err, &p) != permanent {
+			t.Errorf("状态 %d 的错误 %v，永久性错误应为 %v", status, err, permanent)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"go-oak/poller"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultMeasurement 默认的 measurement 名称
+const DefaultMeasurement = "modbus"
+
+// Point 一个时序数据点
+type Point struct {
+	Measurement string             `json:"measurement"`
+	Tags        map[string]string  `json:"tags"`
+	Fields      map[string]float64 `json:"fields"`
+	Time        time.Time          `json:"time"`
+}
+
+// Sink 时序数据的写入目标，例如 InfluxDB
+type Sink interface {
+	// Write 写入一批数据点，返回错误时这一批会被缓存后重试，
+	// 返回 *PermanentError 时重试也不会成功，这一批被丢弃
+	Write(points []Point) error
+	Close() error
+}
+
+// PermanentError 重试也不会成功的写入错误，例如数据被拒绝或认证失败
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// FromReading 把采集结果转换成数据点，按设备、站号和点位名称打标签，
+// 读取失败或值为 NaN、±Inf（例如 float32 点位的无效值）的结果返回 false
+func FromReading(measurement string, r *poller.Reading) (p Point, ok bool) {
+	if r.Err != nil || math.IsNaN(r.Value) || math.IsInf(r.Value, 0) {
+		return
+	}
+	p = Point{
+		Measurement: measurement,
+		Tags: map[string]string{
+			"device":  r.Device.Name,
+			"unit_id": strconv.Itoa(int(r.Device.UnitID)),
+			"tag":     r.Tag.Name,
+		},
+		Fields: map[string]float64{"value": r.Value},
+		Time:   r.Time,
+	}
+	if r.Tag.Unit != "" {
+		p.Tags["unit"] = r.Tag.Unit
+	}
+	return p, true
+}
+
+// Batcher 把采集结果攒成批写入 Sink。写入失败时把数据点缓存到磁盘，
+// 下次写入成功前先补写缓存的数据，Sink 暂时不可用时数据不会丢失。
+type Batcher struct {
+	// Measurement 数据点的 measurement 名称
+	Measurement string
+	// BatchSize 攒够多少个数据点立即写入
+	BatchSize int
+	// FlushInterval 最长多久写入一次
+	FlushInterval time.Duration
+	// Buffer 写入失败时的磁盘缓存，nil 表示丢弃
+	Buffer *DiskBuffer
+
+	sink    Sink
+	mu      sync.Mutex
+	pending []Point
+	full    chan struct{}
+}
+
+// NewBatcher 创建 Batcher，需要调用 Run 才会写入
+func NewBatcher(s Sink) *Batcher {
+	return &Batcher{
+		Measurement:   DefaultMeasurement,
+		BatchSize:     500,
+		FlushInterval: 10 * time.Second,
+		sink:          s,
+		full:          make(chan struct{}, 1),
+	}
+}
+
+// HandleReading 实现 poller.Handler
+func (b *Batcher) HandleReading(r *poller.Reading) {
+	if p, ok := FromReading(b.Measurement, r); ok {
+		b.Add(p)
+	}
+}
+
+// Add 添加数据点，攒够一批时通知 Run 写入
+func (b *Batcher) Add(p Point) {
+	b.mu.Lock()
+	b.pending = append(b.pending, p)
+	n := len(b.pending)
+	b.mu.Unlock()
+	if n >= b.batchSize() {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run 定时写入，直到 ctx 结束，结束前写入剩余的数据点
+func (b *Batcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := b.Flush(); err != nil {
+				log.Printf("sink: %v", err)
+			}
+			return
+		case <-ticker.C:
+		case <-b.full:
+		}
+		if err := b.Flush(); err != nil {
+			log.Printf("sink: %v", err)
+		}
+	}
+}
+
+// Flush 先补写磁盘缓存，再写入待写的数据点，失败的数据点写入磁盘缓存
+func (b *Batcher) Flush() (err error) {
+	b.mu.Lock()
+	points := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+
+	if b.Buffer != nil {
+		if err = b.drain(); err != nil {
+			return b.keep(points, err)
+		}
+	}
+	if len(points) == 0 {
+		return
+	}
+	size := b.batchSize()
+	for start := 0; start < len(points); start += size {
+		end := start + size
+		if end > len(points) {
+			end = len(points)
+		}
+		if err = b.write(points[start:end]); err != nil {
+			return b.keep(points[start:], err)
+		}
+	}
+	return
+}
+
+// drain 补写磁盘缓存中的数据点，全部成功后清空缓存
+func (b *Batcher) drain() error {
+	buffered, err := b.Buffer.Load()
+	if err != nil || len(buffered) == 0 {
+		return err
+	}
+	size := b.batchSize()
+	for start := 0; start < len(buffered); start += size {
+		end := start + size
+		if end > len(buffered) {
+			end = len(buffered)
+		}
+		if err = b.write(buffered[start:end]); err != nil {
+			// 已经写入的部分从缓存中去掉
+			if e := b.Buffer.Replace(buffered[start:]); e != nil {
+				log.Printf("sink: %v", e)
+			}
+			return err
+		}
+	}
+	log.Printf("sink: 已补写缓存的 %d 个数据点", len(buffered))
+	return b.Buffer.Replace(nil)
+}
+
+// write 写入一批数据点，永久性错误时丢弃这一批，不再重试，
+// 否则这一批会一直留在缓存最前面，之后的数据都写不进去
+func (b *Batcher) write(points []Point) error {
+	err := b.sink.Write(points)
+	var permanent *PermanentError
+	if errors.As(err, &permanent) {
+		log.Printf("sink: 丢弃 %d 个数据点: %v", len(points), err)
+		return nil
+	}
+	return err
+}
+
+func (b *Batcher) batchSize() int {
+	if b.BatchSize <= 0 {
+		return 500
+	}
+	return b.BatchSize
+}
+
+// keep 把写入失败的数据点保存到磁盘缓存
+func (b *Batcher) keep(points []Point, err error) error {
+	if b.Buffer == nil {
+		log.Printf("sink: 丢弃 %d 个数据点", len(points))
+		return err
+	}
+	if e := b.Buffer.Append(points); e != nil {
+		log.Printf("sink: 缓存 %d 个数据点失败: %v", len(points), e)
+	}
+	return err
+}
+
+// Close 写入剩余的数据点并关闭 Sink
+func (b *Batcher) Close() error {
+	if err := b.Flush(); err != nil {
+		log.Printf("sink: %v", err)
+	}
+	return b.sink.Close()
+}
@@ -0,0 +1,73 @@
+package util
+
+import (
+	"math"
+	"time"
+)
+
+// Deadband 变化检测。值与上一次输出的值相差超过死区，或距上一次输出超过 Heartbeat 时才输出，
+// 用于过滤 BytesToNFloat 等转换得到的重复读数。
+type Deadband struct {
+	// Absolute 绝对死区，变化量大于它才算变化
+	Absolute float64
+	// Percent 百分比死区，相对上一次输出值的变化百分比大于它才算变化
+	Percent float64
+	// Heartbeat 最长静默时间，超过后即使值没有变化也输出一次，0 表示不限制
+	Heartbeat time.Duration
+
+	last float64
+	at   time.Time
+	has  bool
+}
+
+// Enabled 是否设置了死区或心跳，没有设置时每个值都输出
+func (d *Deadband) Enabled() bool {
+	return d.Absolute > 0 || d.Percent > 0 || d.Heartbeat > 0
+}
+
+// Exceeded 判断 v 相对上一次输出的值是否超过死区，不更新状态
+func (d *Deadband) Exceeded(v float64) bool {
+	if !d.has || math.IsNaN(v) != math.IsNaN(d.last) {
+		return true
+	}
+	diff := math.Abs(v - d.last)
+	if d.Absolute <= 0 && d.Percent <= 0 {
+		return diff != 0
+	}
+	if d.Absolute > 0 && diff > d.Absolute {
+		return true
+	}
+	if d.Percent > 0 {
+		if d.last == 0 {
+			return diff != 0
+		}
+		if diff/math.Abs(d.last)*100 > d.Percent {
+			return true
+		}
+	}
+	return false
+}
+
+// Due 距上一次输出是否已超过 Heartbeat
+func (d *Deadband) Due(now time.Time) bool {
+	return d.Heartbeat > 0 && now.Sub(d.at) >= d.Heartbeat
+}
+
+// Update 判断是否需要输出 v，需要时记录为上一次输出的值
+func (d *Deadband) Update(v float64, now time.Time) bool {
+	if !d.Exceeded(v) && !d.Due(now) {
+		return false
+	}
+	d.Mark(v, now)
+	return true
+}
+
+// Mark 记录 v 为上一次输出的值
+func (d *Deadband) Mark(v float64, now time.Time) {
+	d.last, d.at, d.has = v, now, true
+}
+
+// Reset 清除上一次输出的值，下一个值一定输出
+func (d *Deadband) Reset() {
+	d.has = false
+}
@@ -1,10 +1,40 @@
 package util
 
 import (
+	"fmt"
 	"go.bug.st/serial"
+	"go.bug.st/serial/enumerator"
 	"log"
+	"os"
+	"sort"
+	"strings"
 )
 
+// PortInfo 串口及其 USB 设备信息
+type PortInfo struct {
+	Name         string
+	IsUSB        bool
+	VID          string
+	PID          string
+	SerialNumber string
+	Product      string
+}
+
+func (p PortInfo) String() string {
+	if !p.IsUSB {
+		return p.Name
+	}
+	s := fmt.Sprintf("%s [%s:%s", p.Name, p.VID, p.PID)
+	if p.SerialNumber != "" {
+		s += " SN=" + p.SerialNumber
+	}
+	s += "]"
+	if p.Product != "" {
+		s += " " + p.Product
+	}
+	return s
+}
+
 // GetPorts 获取可用端口列表
 func GetPorts() (ports []string, err error) {
 	// Retrieve the port list
@@ -24,13 +54,140 @@ func GetPorts() (ports []string, err error) {
 	return
 }
 
-// ConnectDefault 根据给定的 Mode 连接
-func ConnectDefault(mode *serial.Mode) (port serial.Port, err error) {
-	ports, err := GetPorts()
+// ListPorts 获取可用端口及其 VID、PID、序列号和产品名，按端口名排序。
+// 平台不支持详细枚举时只返回端口名。
+func ListPorts() (ports []PortInfo, err error) {
+	details, err := enumerator.GetDetailedPortsList()
 	if err != nil {
-		log.Fatal(err)
+		var names []string
+		if names, err = serial.GetPortsList(); err != nil {
+			return
+		}
+		for _, name := range names {
+			ports = append(ports, PortInfo{Name: name})
+		}
+	} else {
+		for _, d := range details {
+			ports = append(ports, PortInfo{
+				Name:         d.Name,
+				IsUSB:        d.IsUSB,
+				VID:          strings.ToUpper(d.VID),
+				PID:          strings.ToUpper(d.PID),
+				SerialNumber: d.SerialNumber,
+				Product:      d.Product,
+			})
+		}
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Name < ports[j].Name })
+	return
+}
+
+// Match 判断端口是否满足选择器。选择器可以是：
+//
+//	COM3、/dev/ttyUSB0       端口名
+//	1A86:7523                 USB VID:PID
+//	vid=1A86,pid=7523         按属性，多个条件用逗号分隔，需全部满足
+//	serial=A50285BI           USB 序列号
+//	product=CH340             产品名包含该字符串（不区分大小写）
+//
+// 空选择器匹配所有端口。
+func (p PortInfo) Match(selector string) bool {
+	selector = strings.TrimSpace(selector)
+	if selector == "" || selector == p.Name {
+		return true
+	}
+	if !strings.Contains(selector, "=") {
+		if vid, pid, ok := strings.Cut(selector, ":"); ok && p.IsUSB && !strings.ContainsAny(selector, `/\`) {
+			return strings.EqualFold(vid, p.VID) && strings.EqualFold(pid, p.PID)
+		}
+		return false
+	}
+	for _, cond := range strings.Split(selector, ",") {
+		key, value, _ := strings.Cut(cond, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		var ok bool
+		switch key {
+		case "name", "port":
+			ok = p.Name == value
+		case "vid":
+			ok = p.IsUSB && strings.EqualFold(p.VID, value)
+		case "pid":
+			ok = p.IsUSB && strings.EqualFold(p.PID, value)
+		case "serial", "sn":
+			ok = p.IsUSB && p.SerialNumber == value
+		case "product":
+			ok = strings.Contains(strings.ToLower(p.Product), strings.ToLower(value))
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// FindPorts 返回所有满足选择器的端口
+func FindPorts(selector string) (ports []PortInfo, err error) {
+	all, err := ListPorts()
+	if err != nil {
+		return
+	}
+	for _, p := range all {
+		if p.Match(selector) {
+			ports = append(ports, p)
+		}
+	}
+	if len(ports) == 0 {
+		// 不在枚举结果中的设备文件（如 /dev/serial/by-id/ 下的链接）按路径直接使用
+		if _, statErr := os.Stat(selector); statErr == nil && !strings.Contains(selector, "=") {
+			ports = append(ports, PortInfo{Name: selector})
+			return
+		}
+		err = fmt.Errorf("未找到匹配 '%s' 的串口", selector)
 	}
-	port, err = serial.Open(ports[0], mode)
+	return
+}
+
+// SelectPort 返回唯一满足选择器的端口，匹配到多个端口时报错，
+// 避免在插有多个转换器的机器上连到错误的端口。
+// 选择器为空时返回按名称排序的第一个端口。
+func SelectPort(selector string) (port PortInfo, err error) {
+	ports, err := FindPorts(selector)
+	if err != nil {
+		return
+	}
+	if len(ports) > 1 && strings.TrimSpace(selector) != "" {
+		names := make([]string, len(ports))
+		for i, p := range ports {
+			names[i] = p.String()
+		}
+		err = fmt.Errorf("'%s' 匹配到多个串口: %s", selector, strings.Join(names, "; "))
+		return
+	}
+	if len(ports) > 1 {
+		log.Printf("找到 %d 个串口，使用 %s，可通过 --port 指定", len(ports), ports[0])
+	}
+	port = ports[0]
+	return
+}
+
+// Connect 打开满足选择器的端口，设备掉线后自动重连
+func Connect(selector string, mode *serial.Mode) (port serial.Port, err error) {
+	info, err := SelectPort(selector)
+	if err != nil {
+		return
+	}
+	rp, err := OpenReconnect(info.Name, mode)
+	if err != nil {
+		return
+	}
+	port = rp
+	return
+}
+
+// ConnectDefault 根据给定的 Mode 连接，设备掉线后自动重连
+func ConnectDefault(mode *serial.Mode) (port serial.Port, err error) {
+	port, err = Connect("", mode)
 	if err != nil {
 		log.Fatal(err)
 	}
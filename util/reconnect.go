@@ -0,0 +1,297 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+// ErrPortLost 设备掉线后在限定时间内没有重新出现
+var ErrPortLost = errors.New("串口设备丢失")
+
+// errPortClosed 端口已被 Close
+var errPortClosed = errors.New("端口已关闭")
+
+const (
+	defaultReconnectTimeout  = 30 * time.Second
+	defaultReconnectInterval = 500 * time.Millisecond
+)
+
+// ReconnectPort 包装 serial.Port，USB 转串口被拔出再插入后自动重新打开。
+//
+// 发生 I/O 错误且设备已从系统中消失时，会重新枚举端口，
+// 优先按 USB VID/PID/序列号匹配原设备（插回后端口名可能变化），
+// 以相同的 serial.Mode 重新打开，并重试当前未完成的读写操作。
+type ReconnectPort struct {
+	// Timeout 等待设备重新出现的最长时间，<= 0 表示一直等待
+	Timeout time.Duration
+	// Interval 重新枚举端口的间隔
+	Interval time.Duration
+
+	mu          sync.Mutex
+	port        serial.Port
+	name        string
+	mode        serial.Mode
+	info        PortInfo
+	readTimeout time.Duration
+	closed      bool
+	// done 在 Close 时关闭，通知正在等待重连的操作退出
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// OpenReconnect 打开端口并返回可自动重连的 ReconnectPort
+func OpenReconnect(name string, mode *serial.Mode) (*ReconnectPort, error) {
+	port, err := serial.Open(name, mode)
+	if err != nil {
+		return nil, err
+	}
+	return &ReconnectPort{
+		Timeout:     defaultReconnectTimeout,
+		Interval:    defaultReconnectInterval,
+		port:        port,
+		name:        name,
+		mode:        *mode,
+		info:        portInfo(name),
+		readTimeout: serial.NoTimeout,
+		done:        make(chan struct{}),
+	}, nil
+}
+
+// Name 返回当前打开的端口名，重连后可能与最初打开的不同
+func (p *ReconnectPort) Name() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.name
+}
+
+func (p *ReconnectPort) Read(b []byte) (n int, err error) {
+	err = p.do(func(port serial.Port) (e error) {
+		n, e = port.Read(b)
+		return
+	})
+	return
+}
+
+func (p *ReconnectPort) Write(b []byte) (n int, err error) {
+	err = p.do(func(port serial.Port) (e error) {
+		n, e = port.Write(b)
+		return
+	})
+	return
+}
+
+func (p *ReconnectPort) SetMode(mode *serial.Mode) error {
+	return p.do(func(port serial.Port) error {
+		if err := port.SetMode(mode); err != nil {
+			return err
+		}
+		p.mode = *mode
+		return nil
+	})
+}
+
+func (p *ReconnectPort) SetReadTimeout(t time.Duration) error {
+	return p.do(func(port serial.Port) error {
+		if err := port.SetReadTimeout(t); err != nil {
+			return err
+		}
+		p.readTimeout = t
+		return nil
+	})
+}
+
+func (p *ReconnectPort) ResetInputBuffer() error {
+	return p.do(func(port serial.Port) error { return port.ResetInputBuffer() })
+}
+
+func (p *ReconnectPort) ResetOutputBuffer() error {
+	return p.do(func(port serial.Port) error { return port.ResetOutputBuffer() })
+}
+
+func (p *ReconnectPort) SetDTR(dtr bool) error {
+	return p.do(func(port serial.Port) error { return port.SetDTR(dtr) })
+}
+
+func (p *ReconnectPort) SetRTS(rts bool) error {
+	return p.do(func(port serial.Port) error { return port.SetRTS(rts) })
+}
+
+func (p *ReconnectPort) GetModemStatusBits() (bits *serial.ModemStatusBits, err error) {
+	err = p.do(func(port serial.Port) (e error) {
+		bits, e = port.GetModemStatusBits()
+		return
+	})
+	return
+}
+
+// Close 关闭端口，之后不再重连。正在等待设备重新连接的操作会立即返回
+func (p *ReconnectPort) Close() error {
+	// 先通知重连循环退出，否则要等到重连超时才能拿到锁
+	p.closeOnce.Do(func() { close(p.done) })
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	if p.port == nil {
+		return nil
+	}
+	err := p.port.Close()
+	p.port = nil
+	return err
+}
+
+// WaitReplug 等待设备被拔出并重新插入，然后重新打开端口。
+// 用于更改站号等需要设备重新上电才能生效的场景。
+func (p *ReconnectPort) WaitReplug(timeout time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return errPortClosed
+	}
+	deadline := time.Now().Add(timeout)
+	for p.present() {
+		if timeout > 0 && time.Now().After(deadline) {
+			return fmt.Errorf("等待设备 %s 拔出超时", p.name)
+		}
+		if err := p.wait(); err != nil {
+			return err
+		}
+	}
+	log.Printf("设备 %s 已拔出", p.name)
+	return p.reconnect()
+}
+
+// do 执行一次端口操作，设备掉线时重连并重试一次
+func (p *ReconnectPort) do(op func(port serial.Port) error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return errPortClosed
+	}
+	if p.port == nil {
+		// 上次重连没有成功，继续尝试
+		if err := p.reconnect(); err != nil {
+			return err
+		}
+	}
+	err := op(p.port)
+	if err == nil || !p.lost(err) {
+		return err
+	}
+	log.Printf("端口 %s 异常(%v)，等待设备重新连接...", p.name, err)
+	if err = p.reconnect(); err != nil {
+		return err
+	}
+	return op(p.port)
+}
+
+// lost 判断错误是否由设备掉线引起
+func (p *ReconnectPort) lost(err error) bool {
+	var portErr *serial.PortError
+	if errors.As(err, &portErr) && portErr.Code() == serial.PortClosed {
+		return true
+	}
+	if errors.Is(err, syscall.EIO) || errors.Is(err, syscall.ENXIO) || errors.Is(err, syscall.ENODEV) {
+		return true
+	}
+	return !p.present()
+}
+
+// present 判断原设备当前是否仍在端口列表中
+func (p *ReconnectPort) present() bool {
+	_, ok := p.find()
+	return ok
+}
+
+// find 重新枚举端口，返回与原设备匹配的端口名
+func (p *ReconnectPort) find() (string, bool) {
+	ports, err := ListPorts()
+	if err != nil {
+		return "", false
+	}
+	var candidate string
+	for _, info := range ports {
+		if !p.info.IsUSB {
+			if info.Name == p.name {
+				return info.Name, true
+			}
+			continue
+		}
+		if !info.IsUSB || info.VID != p.info.VID || info.PID != p.info.PID {
+			continue
+		}
+		if p.info.SerialNumber != "" {
+			if info.SerialNumber == p.info.SerialNumber {
+				return info.Name, true
+			}
+			continue
+		}
+		// 没有序列号时优先使用原端口名
+		if info.Name == p.name {
+			return info.Name, true
+		}
+		if candidate == "" {
+			candidate = info.Name
+		}
+	}
+	return candidate, candidate != ""
+}
+
+// reconnect 关闭旧端口，等待设备重新出现后以相同 Mode 打开
+func (p *ReconnectPort) reconnect() error {
+	if p.port != nil {
+		_ = p.port.Close()
+		p.port = nil
+	}
+	deadline := time.Now().Add(p.Timeout)
+	for {
+		if name, ok := p.find(); ok {
+			port, err := serial.Open(name, &p.mode)
+			if err == nil {
+				if err = port.SetReadTimeout(p.readTimeout); err == nil {
+					if name != p.name {
+						log.Printf("设备已重新连接: %s -> %s", p.name, name)
+					} else {
+						log.Printf("设备已重新连接: %s", name)
+					}
+					p.port = port
+					p.name = name
+					return nil
+				}
+				_ = port.Close()
+			}
+		}
+		if p.Timeout > 0 && time.Now().After(deadline) {
+			return fmt.Errorf("%w: %s", ErrPortLost, p.name)
+		}
+		if err := p.wait(); err != nil {
+			return err
+		}
+	}
+}
+
+// wait 等待一个枚举间隔，端口被 Close 时返回 errPortClosed
+func (p *ReconnectPort) wait() error {
+	select {
+	case <-p.done:
+		return errPortClosed
+	case <-time.After(p.Interval):
+		return nil
+	}
+}
+
+// portInfo 获取端口的 USB 信息，获取失败时只有端口名
+func portInfo(name string) PortInfo {
+	ports, _ := ListPorts()
+	for _, info := range ports {
+		if info.Name == name {
+			return info
+		}
+	}
+	return PortInfo{Name: name}
+}
@@ -0,0 +1,76 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DailyWriter 按天切换文件的 Writer。Path 为 data/th.csv 时，
+// 2022-08-01 的数据写入 data/th-2022-08-01.csv，文件已存在时追加。
+type DailyWriter struct {
+	// Path 文件路径模板，日期插在扩展名之前
+	Path string
+	// Header 新建（或空）文件时先写入的内容，例如 CSV 表头
+	Header []byte
+
+	mu  sync.Mutex
+	day string
+	f   *os.File
+}
+
+// NewDailyWriter 创建按天切换文件的 Writer，文件在第一次写入时打开
+func NewDailyWriter(path string, header []byte) *DailyWriter {
+	return &DailyWriter{Path: path, Header: header}
+}
+
+// Write 把 p 写入当天的文件。每次调用写入同一个文件，一条记录应一次写入
+func (w *DailyWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if day := time.Now().Format("2006-01-02"); day != w.day || w.f == nil {
+		if err = w.open(day); err != nil {
+			return
+		}
+	}
+	return w.f.Write(p)
+}
+
+// FileName 返回指定日期的文件名
+func (w *DailyWriter) FileName(day string) string {
+	ext := filepath.Ext(w.Path)
+	return strings.TrimSuffix(w.Path, ext) + "-" + day + ext
+}
+
+func (w *DailyWriter) open(day string) (err error) {
+	if w.f != nil {
+		_ = w.f.Close()
+		w.f = nil
+	}
+	f, err := os.OpenFile(w.FileName(day), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	if info, err := f.Stat(); err == nil && info.Size() == 0 && len(w.Header) > 0 {
+		if _, err = f.Write(w.Header); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	w.f, w.day = f, day
+	return
+}
+
+// Close 关闭当前的文件
+func (w *DailyWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
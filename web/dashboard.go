@@ -0,0 +1,16 @@
+package web
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Dashboard 返回内嵌在程序中的网页，通过 /devices 和 /ws 显示点位的实时值
+func Dashboard() http.Handler {
+	sub, _ := fs.Sub(static, "static")
+	return http.FileServer(http.FS(sub))
+}
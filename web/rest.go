@@ -0,0 +1,332 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-oak/cli"
+	"go-oak/poller"
+	"go-oak/regmap"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Server 通过 HTTP 读写设备。所有请求经过 Poller 的连接访问总线，
+// 与轮询和其他请求互斥。
+//
+//	GET  /devices                                  配置文件中的设备
+//	GET  /devices/{id}/{area}/{addr}?count=&type=&scale=
+//	PUT  /devices/{id}/{area}/{addr}?type=&scale=  请求体 {"value": 1} 或 {"values": [1, 2]}
+//	GET  /devices/{name}/tags/{tag}
+//	PUT  /devices/{name}/tags/{tag}                请求体 {"value": 1}
+//	PUT  /devices/{name}/tags/{tag}.{bit}          只修改保持寄存器中的一位，值非 0 置 1，响应为整个点位的值
+//
+// {id} 可以是站号（使用 ?connection= 指定的连接或默认连接），也可以是配置文件中的设备名。
+// 串口连接上站号 0 为广播地址，不能访问；TCP 连接上站号 0 按普通站号访问。
+type Server struct {
+	// CORSOrigin 非空时设置 Access-Control-Allow-Origin
+	CORSOrigin string
+
+	poller *poller.Poller
+	mux    *http.ServeMux
+}
+
+// NewServer 创建 HTTP 服务
+func NewServer(p *poller.Poller) *Server {
+	s := &Server{poller: p, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/devices", s.handleDevices)
+	s.mux.HandleFunc("/devices/", s.handleDevice)
+	return s
+}
+
+// Handle 注册其他处理函数，例如 WebSocket
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.CORSOrigin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", s.CORSOrigin)
+		w.Header().Set("Access-Control-Allow-Methods", "GET, PUT, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// DeviceInfo GET /devices 返回的设备信息
+type DeviceInfo struct {
+	Name       string        `json:"name"`
+	Connection string        `json:"connection,omitempty"`
+	UnitID     byte          `json:"unit_id"`
+	Tags       []*regmap.Tag `json:"tags"`
+}
+
+// Values 按地址读写的请求和响应
+type Values struct {
+	UnitID  byte        `json:"unit_id"`
+	Area    regmap.Area `json:"area"`
+	Address uint16      `json:"address"`
+	Type    string      `json:"type"`
+	Values  []float64   `json:"values"`
+}
+
+// TagValue 按点位读写的请求和响应
+type TagValue struct {
+	Device string   `json:"device"`
+	Tag    string   `json:"tag"`
+	Value  *float64 `json:"value"`
+	Unit   string   `json:"unit,omitempty"`
+}
+
+// writeRequest PUT 的请求体
+type writeRequest struct {
+	Value  *float64  `json:"value"`
+	Values []float64 `json:"values"`
+}
+
+// Error 错误响应，Exception 为从站返回的异常码
+type Error struct {
+	Error     string `json:"error"`
+	Exception byte   `json:"exception,omitempty"`
+}
+
+// badRequest 请求参数错误
+type badRequest struct{ error }
+
+// notFound 设备或点位不存在
+type notFound struct{ error }
+
+func (s *Server) handleDevices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, errMethod)
+		return
+	}
+	devices := s.poller.Database().Devices()
+	res := make([]DeviceInfo, 0, len(devices))
+	for _, d := range devices {
+		res = append(res, DeviceInfo{Name: d.Name, Connection: d.Connection, UnitID: d.UnitID, Tags: d.Map.Tags()})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+var errMethod = errors.New("不支持的请求方法")
+
+func (s *Server) handleDevice(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/devices/"), "/"), "/")
+	if len(parts) != 3 {
+		writeError(w, notFound{fmt.Errorf("路径 %s 不存在", r.URL.Path)})
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		writeError(w, errMethod)
+		return
+	}
+	var (
+		res interface{}
+		err error
+	)
+	if parts[1] == "tags" {
+		res, err = s.tag(w, r, parts[0], parts[2])
+	} else {
+		res, err = s.block(w, r, parts[0], parts[1], parts[2])
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// tag 读写配置文件中的点位
+func (s *Server) tag(w http.ResponseWriter, r *http.Request, device, tag string) (res *TagValue, err error) {
+	d, err := s.poller.Database().Device(device)
+	if err != nil {
+		return nil, notFound{err}
+	}
+	name, bit, isBit := d.SplitBit(tag)
+	if !isBit {
+		name = tag
+	}
+	t, err := d.Map.Tag(name)
+	if err != nil {
+		return nil, notFound{err}
+	}
+	res = &TagValue{Device: d.Name, Tag: t.Name, Unit: t.Unit}
+	if r.Method == http.MethodPut {
+		var req writeRequest
+		if err = decodeBody(w, r, &req); err != nil {
+			return
+		}
+		if req.Value == nil {
+			return nil, badRequest{errors.New("请求体中没有 value")}
+		}
+		if !t.Writable() {
+			return nil, badRequest{fmt.Errorf("点位 %s 不可写", t.Name)}
+		}
+		if isBit {
+			// 读改写期间持有总线
+			err = s.poller.WriteBit(d.Name, t.Name, bit, *req.Value != 0)
+		} else if _, err = t.Encode(*req.Value); err != nil {
+			return nil, badRequest{err}
+		} else {
+			err = s.poller.Write(d.Name, t.Name, *req.Value)
+		}
+		if err != nil {
+			return
+		}
+		if !t.Readable() {
+			res.Value = req.Value
+			return
+		}
+	}
+	reading, err := s.poller.Read(d.Name, t.Name)
+	if err != nil {
+		return
+	}
+	res.Value = &reading.Value
+	return
+}
+
+// block 按站号、数据区和地址读写
+func (s *Server) block(w http.ResponseWriter, r *http.Request, id, area, addr string) (res *Values, err error) {
+	connection, unit, err := s.resolve(r, id)
+	if err != nil {
+		return
+	}
+	b := &regmap.Block{Count: 1}
+	if b.Area, err = regmap.ParseArea(area); err != nil {
+		return nil, notFound{err}
+	}
+	address, err := strconv.ParseUint(addr, 10, 16)
+	if err != nil {
+		return nil, badRequest{fmt.Errorf("地址 '%s' 不合法", addr)}
+	}
+	b.Address = uint16(address)
+	query := r.URL.Query()
+	if b.Type, err = regmap.ParseDataType(query.Get("type")); err != nil {
+		return nil, badRequest{err}
+	}
+	if v := query.Get("scale"); v != "" {
+		if b.Scale, err = strconv.ParseFloat(v, 64); err != nil {
+			return nil, badRequest{fmt.Errorf("倍率 '%s' 不合法", v)}
+		}
+	}
+	if v := query.Get("count"); v != "" {
+		count, err := strconv.ParseUint(v, 10, 16)
+		if err != nil || count == 0 {
+			return nil, badRequest{fmt.Errorf("数量 '%s' 不合法", v)}
+		}
+		b.Count = uint16(count)
+	}
+	if err = b.Validate(); err != nil {
+		return nil, badRequest{err}
+	}
+
+	var values []float64
+	if r.Method == http.MethodPut {
+		var req writeRequest
+		if err = decodeBody(w, r, &req); err != nil {
+			return
+		}
+		values = req.Values
+		if req.Value != nil {
+			values = append([]float64{*req.Value}, values...)
+		}
+		if len(values) == 0 {
+			return nil, badRequest{errors.New("请求体中没有 value 或 values")}
+		}
+		if !b.Area.Writable() {
+			return nil, badRequest{fmt.Errorf("%v 区不可写", b.Area)}
+		}
+		if _, err = b.Encode(values); err != nil {
+			return nil, badRequest{err}
+		}
+	}
+	err = s.poller.Do(connection, func(c cli.Client) (err error) {
+		c.SetSlaveId(unit)
+		if values != nil {
+			if err = b.Write(c, values); err != nil {
+				return
+			}
+		}
+		values, err = b.Read(c)
+		return
+	})
+	if err != nil {
+		return
+	}
+	return &Values{UnitID: unit, Area: b.Area, Address: b.Address, Type: b.Type.String(), Values: values}, nil
+}
+
+// resolve 把 {id} 解析成连接名和站号。{id} 为站号时连接由 ?connection= 指定，
+// 没有指定时使用默认连接，与配置中的设备共用同一条总线
+func (s *Server) resolve(r *http.Request, id string) (connection string, unit byte, err error) {
+	if n, e := strconv.ParseUint(id, 10, 8); e == nil {
+		return s.poller.ConnectionName(r.URL.Query().Get("connection")), byte(n), nil
+	}
+	d, err := s.poller.Database().Device(id)
+	if err != nil {
+		return "", 0, notFound{err}
+	}
+	return d.Connection, d.UnitID, nil
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(v); err != nil {
+		return badRequest{fmt.Errorf("请求体不合法: %w", err)}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status, body := StatusCode(err), Error{Error: err.Error()}
+	var mbErr *cli.ModbusError
+	if errors.As(err, &mbErr) {
+		body.Exception = mbErr.ExceptionCode
+	}
+	writeJSON(w, status, body)
+}
+
+// StatusCode 把错误转换成 HTTP 状态码，从站返回的异常码按含义对应
+func StatusCode(err error) int {
+	var (
+		mbErr *cli.ModbusError
+		bad   badRequest
+		nf    notFound
+	)
+	switch {
+	case errors.Is(err, errMethod):
+		return http.StatusMethodNotAllowed
+	case errors.As(err, &bad):
+		return http.StatusBadRequest
+	case errors.As(err, &nf):
+		return http.StatusNotFound
+	case errors.Is(err, cli.ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+	case cli.IsTimeout(err):
+		return http.StatusGatewayTimeout
+	case errors.As(err, &mbErr):
+		switch mbErr.ExceptionCode {
+		case cli.ExceptionCodeIllegalFunction:
+			return http.StatusNotImplemented
+		case cli.ExceptionCodeIllegalDataAddress:
+			return http.StatusNotFound
+		case cli.ExceptionCodeIllegalDataValue:
+			return http.StatusUnprocessableEntity
+		case cli.ExceptionCodeAcknowledge, cli.ExceptionCodeServerDeviceBusy:
+			return http.StatusServiceUnavailable
+		}
+	}
+	return http.StatusBadGateway
+}
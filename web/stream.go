@@ -0,0 +1,219 @@
+package web
+
+import (
+	"encoding/json"
+	"go-oak/poller"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// sendBuffer 每个客户端待发送事件的缓冲，满了说明客户端太慢，断开它
+	sendBuffer = 256
+	writeWait  = 10 * time.Second
+	pingPeriod = 30 * time.Second
+)
+
+// Event 推送给浏览器的点位变化
+type Event struct {
+	Device string    `json:"device"`
+	Tag    string    `json:"tag"`
+	Value  *float64  `json:"value,omitempty"`
+	Unit   string    `json:"unit,omitempty"`
+	Time   time.Time `json:"time"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// changed 与上一次的事件相比值或错误是否有变化
+func (e *Event) changed(last *Event) bool {
+	if last == nil || e.Error != last.Error || (e.Value == nil) != (last.Value == nil) {
+		return true
+	}
+	return e.Value != nil && *e.Value != *last.Value
+}
+
+// Subscription 浏览器发来的订阅消息。Device 为空表示所有设备，Tag 为空表示设备的所有点位
+type Subscription struct {
+	// Action subscribe 或 unsubscribe
+	Action string `json:"action"`
+	Device string `json:"device"`
+	Tag    string `json:"tag"`
+}
+
+func (s Subscription) match(device, tag string) bool {
+	return (s.Device == "" || s.Device == device) && (s.Tag == "" || s.Tag == tag)
+}
+
+// Hub 把 Poller 采集到的变化推送给 WebSocket 客户端。
+// 作为 poller.Handler 使用，只在值或错误变化时推送；客户端订阅时先收到当前值。
+type Hub struct {
+	// CORSOrigin 允许跨域连接的来源，* 表示任意来源，为空时只允许同源连接
+	CORSOrigin string
+
+	mu      sync.Mutex
+	last    map[[2]string]*Event
+	clients map[*wsClient]bool
+
+	upgrader websocket.Upgrader
+}
+
+// NewHub 创建 Hub
+func NewHub() *Hub {
+	h := &Hub{
+		last:    make(map[[2]string]*Event),
+		clients: make(map[*wsClient]bool),
+	}
+	h.upgrader.CheckOrigin = h.checkOrigin
+	return h
+}
+
+// checkOrigin 检查 WebSocket 请求的来源：同源，或与 CORSOrigin 一致
+func (h *Hub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || h.CORSOrigin == "*" || origin == h.CORSOrigin {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// HandleReading 实现 poller.Handler
+func (h *Hub) HandleReading(r *poller.Reading) {
+	e := &Event{Device: r.Device.Name, Tag: r.Tag.Name, Unit: r.Tag.Unit, Time: r.Time}
+	if r.Err != nil {
+		e.Error = r.Err.Error()
+	} else {
+		value := r.Value
+		e.Value = &value
+	}
+	key := [2]string{e.Device, e.Tag}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !e.changed(h.last[key]) {
+		return
+	}
+	h.last[key] = e
+	for c := range h.clients {
+		if c.subscribed(e.Device, e.Tag) {
+			h.send(c, e)
+		}
+	}
+}
+
+// send 把事件交给客户端的发送 goroutine，调用者需持有 h.mu
+func (h *Hub) send(c *wsClient, e *Event) {
+	select {
+	case c.events <- e:
+	default:
+		log.Printf("websocket: 客户端 %s 太慢，断开连接", c.conn.RemoteAddr())
+		delete(h.clients, c)
+		close(c.events)
+	}
+}
+
+// ServeHTTP 把请求升级为 WebSocket 连接
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &wsClient{conn: conn, events: make(chan *Event, sendBuffer)}
+	h.mu.Lock()
+	h.clients[c] = true
+	h.mu.Unlock()
+	go c.writeLoop()
+	h.readLoop(c)
+}
+
+// readLoop 处理客户端的订阅消息，直到连接断开
+func (h *Hub) readLoop(c *wsClient) {
+	defer func() {
+		h.mu.Lock()
+		if h.clients[c] {
+			delete(h.clients, c)
+			close(c.events)
+		}
+		h.mu.Unlock()
+		c.conn.Close()
+	}()
+	for {
+		var sub Subscription
+		if err := c.conn.ReadJSON(&sub); err != nil {
+			return
+		}
+		h.mu.Lock()
+		switch sub.Action {
+		case "subscribe":
+			c.subs = append(c.subs, sub)
+			// 先发送当前值
+			for key, e := range h.last {
+				if sub.match(key[0], key[1]) && h.clients[c] {
+					h.send(c, e)
+				}
+			}
+		case "unsubscribe":
+			c.unsubscribe(sub)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// wsClient 一个 WebSocket 连接，subs 由 Hub.mu 保护
+type wsClient struct {
+	conn   *websocket.Conn
+	events chan *Event
+	subs   []Subscription
+}
+
+func (c *wsClient) subscribed(device, tag string) bool {
+	for _, s := range c.subs {
+		if s.match(device, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// unsubscribe 取消与 sub 相同或被 sub 包含的订阅
+func (c *wsClient) unsubscribe(sub Subscription) {
+	subs := c.subs[:0]
+	for _, s := range c.subs {
+		if (sub.Device != "" && sub.Device != s.Device) || (sub.Tag != "" && sub.Tag != s.Tag) {
+			subs = append(subs, s)
+		}
+	}
+	c.subs = subs
+}
+
+func (c *wsClient) writeLoop() {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case e, ok := <-c.events:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				_ = c.conn.WriteMessage(websocket.CloseMessage, nil)
+				c.conn.Close()
+				return
+			}
+			data, _ := json.Marshal(e)
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				c.conn.Close()
+				return
+			}
+		case <-ticker.C:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.conn.Close()
+				return
+			}
+		}
+	}
+}